@@ -0,0 +1,102 @@
+// gosignify-plugin-file is the reference signer plugin for gosignify. It signs
+// with an unencrypted Ed25519 key stored in a file and is meant as a starting
+// point for writing plugins for key management systems.
+//
+// Create a key and export its public key:
+//
+//	gosignify-plugin-file -generate key.plugin
+//	gosignify -G -p key.pub -s plugin:file:key.plugin
+//
+// Sign a message with it:
+//
+//	gosignify -S -s plugin:file:key.plugin -m message.txt
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/plugin"
+)
+
+// key file format: base64(keynum || Ed25519 seed)
+const keysize = plugin.KeynumSize + ed25519.SeedSize
+
+type fileSigner struct {
+	keynum  [plugin.KeynumSize]byte
+	key     ed25519.PrivateKey
+	comment string
+}
+
+func (s *fileSigner) Keynum() [plugin.KeynumSize]byte {
+	return s.keynum
+}
+
+func (s *fileSigner) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+func (s *fileSigner) Comment() string {
+	return s.comment
+}
+
+func (s *fileSigner) Sign(msg []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, msg), nil
+}
+
+func open(filename string) (plugin.Signer, error) {
+	if filename == "" {
+		return nil, errors.New("no key file given")
+	}
+	b64, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b64)))
+	if err != nil || len(buf) != keysize {
+		return nil, fmt.Errorf("invalid key file %s", filename)
+	}
+	s := &fileSigner{
+		key:     ed25519.NewKeyFromSeed(buf[plugin.KeynumSize:]),
+		comment: fmt.Sprintf("plugin key %s", filename),
+	}
+	copy(s.keynum[:], buf)
+	return s, nil
+}
+
+func generate(filename string) error {
+	buf := make([]byte, keysize)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return err
+	}
+	fd, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	_, err = fmt.Fprintln(fd, base64.StdEncoding.EncodeToString(buf))
+	return err
+}
+
+func main() {
+	keyfile := flag.String("generate", "", "Generate a new key file.")
+	flag.Parse()
+	var err error
+	if *keyfile != "" {
+		err = generate(*keyfile)
+	} else {
+		err = plugin.Serve(os.Stdin, os.Stdout, open)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[0], err)
+		os.Exit(1)
+	}
+}
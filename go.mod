@@ -1,9 +1,13 @@
 module github.com/frankbraun/gosignify
 
-go 1.14
+go 1.27
 
 require (
+	filippo.io/edwards25519 v1.0.0
 	github.com/ebfe/bcrypt_pbkdf v0.0.0-20140212075826-3c8d2dcb253a
-	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de
-	golang.org/x/sys v0.0.0-20200728102440-3e129f6d46b1
+	github.com/miekg/pkcs11 v1.1.1
+	golang.org/x/crypto v0.57.0
+	golang.org/x/sys v0.48.0
 )
+
+require golang.org/x/term v0.46.0 // indirect
@@ -0,0 +1,133 @@
+// Package bech32 implements the Bech32 encoding specified in BIP 173, as used
+// by age for recipients and identities. Unlike BIP 173, the length of encoded
+// strings is not limited.
+package bech32
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var generator = []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpexpand(hrp string) []byte {
+	var v []byte
+	for i := 0; i < len(hrp); i++ {
+		v = append(v, hrp[i]>>5)
+	}
+	v = append(v, 0)
+	for i := 0; i < len(hrp); i++ {
+		v = append(v, hrp[i]&31)
+	}
+	return v
+}
+
+// convertbits regroups the bits of data from frombits to tobits per byte.
+func convertbits(data []byte, frombits, tobits uint, pad bool) ([]byte, error) {
+	var (
+		ret  []byte
+		acc  uint32
+		bits uint
+	)
+	maxv := uint32(1)<<tobits - 1
+	for _, b := range data {
+		if uint32(b)>>frombits != 0 {
+			return nil, errors.New("bech32: invalid data")
+		}
+		acc = acc<<frombits | uint32(b)
+		bits += frombits
+		for bits >= tobits {
+			bits -= tobits
+			ret = append(ret, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			ret = append(ret, byte(acc<<(tobits-bits)&maxv))
+		}
+	} else if bits >= frombits || acc<<(tobits-bits)&maxv != 0 {
+		return nil, errors.New("bech32: invalid padding")
+	}
+	return ret, nil
+}
+
+// Encode encodes data with the human-readable part hrp. The result is in
+// lower case.
+func Encode(hrp string, data []byte) (string, error) {
+	hrp = strings.ToLower(hrp)
+	if hrp == "" {
+		return "", errors.New("bech32: empty human-readable part")
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", fmt.Errorf("bech32: invalid character %q", hrp[i])
+		}
+	}
+	values, err := convertbits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	mod := polymod(append(append(hrpexpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	for i := 0; i < 6; i++ {
+		values = append(values, byte(mod>>uint(5*(5-i))&31))
+	}
+	var s strings.Builder
+	s.WriteString(hrp)
+	s.WriteByte('1')
+	for _, v := range values {
+		s.WriteByte(charset[v])
+	}
+	return s.String(), nil
+}
+
+// Decode decodes s and returns its human-readable part in lower case and its
+// data. Strings in mixed case are rejected.
+func Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("bech32: mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("bech32: invalid separator position")
+	}
+	hrp := s[:pos]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, fmt.Errorf("bech32: invalid character %q", hrp[i])
+		}
+	}
+	var values []byte
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("bech32: invalid character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+	if polymod(append(hrpexpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("bech32: invalid checksum")
+	}
+	data, err := convertbits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
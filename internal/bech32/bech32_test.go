@@ -0,0 +1,66 @@
+package bech32
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	// test vectors from BIP 173
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"11qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqc8247j",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+		"?1ezyfcl",
+	} {
+		hrp, data, err := Decode(s)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+		enc, err := Encode(hrp, data)
+		if err != nil {
+			t.Errorf("%s: %s", s, err)
+			continue
+		}
+		if enc != strings.ToLower(s) {
+			t.Errorf("%s: encoded as %s", s, enc)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	for _, s := range []string{
+		"pzry9x0s0muk",
+		"1pzry9x0s0muk",
+		"x1b4n0q5v",
+		"li1dgmt3",
+		"A1G7SGD8",
+		"10a06t8",
+		"1qzzfhee",
+		"A12Uel5l",
+		"a12uel5m",
+	} {
+		if _, _, err := Decode(s); err == nil {
+			t.Errorf("%s: should fail", s)
+		}
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	data := bytes.Repeat([]byte{0xa5}, 32)
+	s, err := Encode("age", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hrp, dec, err := Decode(strings.ToUpper(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hrp != "age" || !bytes.Equal(dec, data) {
+		t.Errorf("roundtrip failed: %s %x", hrp, dec)
+	}
+}
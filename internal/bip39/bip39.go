@@ -0,0 +1,89 @@
+// Package bip39 encodes binary data as a list of English words with a
+// checksum as specified in BIP 39. Unlike BIP 39, data of any multiple of four
+// bytes is accepted and no seed is derived from the words.
+package bip39
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	words   = strings.Split(strings.TrimSuffix(english, "\n"), "\n")
+	indices = make(map[string]int, len(words))
+)
+
+func init() {
+	for i, w := range words {
+		indices[w] = i
+	}
+}
+
+// bit returns bit i of buf, counted from the most significant bit.
+func bit(buf []byte, i int) int {
+	return int(buf[i/8]>>(7-uint(i%8))) & 1
+}
+
+// Encode encodes data, whose length must be a nonzero multiple of four bytes,
+// as a mnemonic of space separated words. Every word encodes 11 bits of data
+// followed by the first len(data)/4 bits of the SHA-256 hash of data.
+func Encode(data []byte) (string, error) {
+	if len(data) == 0 || len(data)%4 != 0 {
+		return "", errors.New("bip39: invalid data length")
+	}
+	digest := sha256.Sum256(data)
+	buf := append(append([]byte{}, data...), digest[:]...)
+	defer wipe(buf)
+	n := (len(data)*8 + len(data)/4) / 11
+	mnemonic := make([]string, n)
+	for i := range mnemonic {
+		var index int
+		for j := 0; j < 11; j++ {
+			index = index<<1 | bit(buf, i*11+j)
+		}
+		mnemonic[i] = words[index]
+	}
+	return strings.Join(mnemonic, " "), nil
+}
+
+// Decode decodes the mnemonic, whose words may be separated by any white
+// space, and verifies its checksum.
+func Decode(mnemonic string) ([]byte, error) {
+	fields := strings.Fields(strings.ToLower(mnemonic))
+	if len(fields) == 0 || len(fields)%3 != 0 {
+		return nil, errors.New("bip39: invalid number of words")
+	}
+	size := len(fields) * 11 / 33 * 4
+	buf := make([]byte, (len(fields)*11+7)/8)
+	defer wipe(buf)
+	for i, w := range fields {
+		index, ok := indices[w]
+		if !ok {
+			return nil, fmt.Errorf("bip39: unknown word %q", w)
+		}
+		for j := 0; j < 11; j++ {
+			if index>>(10-uint(j))&1 == 1 {
+				k := i*11 + j
+				buf[k/8] |= 1 << (7 - uint(k%8))
+			}
+		}
+	}
+	data := make([]byte, size)
+	copy(data, buf)
+	digest := sha256.Sum256(data)
+	for i := 0; i < size/4; i++ {
+		if bit(buf, size*8+i) != bit(digest[:], i) {
+			wipe(data)
+			return nil, errors.New("bip39: invalid checksum")
+		}
+	}
+	return data, nil
+}
+
+func wipe(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
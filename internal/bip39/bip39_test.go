@@ -0,0 +1,88 @@
+package bip39
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestVectors(t *testing.T) {
+	// test vectors from BIP 39
+	for _, v := range []struct {
+		data     string
+		mnemonic string
+	}{
+		{
+			"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+		},
+		{
+			"ffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+		},
+		{
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			strings.Repeat("abandon ", 23) + "art",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			strings.Repeat("zoo ", 23) + "vote",
+		},
+	} {
+		data, _ := hex.DecodeString(v.data)
+		mnemonic, err := Encode(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mnemonic != v.mnemonic {
+			t.Errorf("%s: encoded as %s", v.data, mnemonic)
+		}
+		dec, err := Decode(v.mnemonic)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dec, data) {
+			t.Errorf("%s: decoded as %x", v.mnemonic, dec)
+		}
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	data := make([]byte, 40)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	mnemonic, err := Encode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(mnemonic)
+	if len(fields) != 30 {
+		t.Fatalf("%d words", len(fields))
+	}
+	dec, err := Decode(strings.ToUpper(strings.Join(fields, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dec, data) {
+		t.Error("wrong data")
+	}
+	if _, err := Decode(strings.Repeat("abandon ", 12)); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := Decode("abandon abandon"); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := Decode(strings.Repeat("abandon ", 11) + "aardvark"); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := Encode(data[:7]); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,259 @@
+// Package cbor implements the small subset of CBOR (RFC 8949) needed to encode
+// and decode COSE structures.
+package cbor
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Major types.
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Simple values.
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+)
+
+// maxDepth limits the nesting of decoded arrays, maps and tags.
+const maxDepth = 16
+
+// Tag is a tagged data item.
+type Tag struct {
+	Number  uint64
+	Content interface{}
+}
+
+// Map is a decoded CBOR map. Integer keys are decoded as int64, text keys as
+// string.
+type Map map[interface{}]interface{}
+
+// Encoder appends CBOR encoded data items to a buffer.
+type Encoder struct {
+	buf []byte
+}
+
+// Bytes returns the encoded data.
+func (e *Encoder) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Encoder) head(major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, m|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, m|25, 0, 0)
+		binary.BigEndian.PutUint16(e.buf[len(e.buf)-2:], uint16(n))
+	case n <= math.MaxUint32:
+		e.buf = append(e.buf, m|26, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(e.buf[len(e.buf)-4:], uint32(n))
+	default:
+		e.buf = append(e.buf, m|27, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(e.buf[len(e.buf)-8:], n)
+	}
+}
+
+// Int encodes the integer i.
+func (e *Encoder) Int(i int64) {
+	if i < 0 {
+		e.head(majorNegInt, uint64(-1-i))
+	} else {
+		e.head(majorUint, uint64(i))
+	}
+}
+
+// ByteString encodes b as a byte string.
+func (e *Encoder) ByteString(b []byte) {
+	e.head(majorBytes, uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+// TextString encodes s as a text string.
+func (e *Encoder) TextString(s string) {
+	e.head(majorText, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// Array encodes the header of an array with n elements.
+func (e *Encoder) Array(n int) {
+	e.head(majorArray, uint64(n))
+}
+
+// Map encodes the header of a map with n key/value pairs.
+func (e *Encoder) Map(n int) {
+	e.head(majorMap, uint64(n))
+}
+
+// Tag encodes the tag number n. The tagged data item must follow.
+func (e *Encoder) Tag(n uint64) {
+	e.head(majorTag, n)
+}
+
+// Null encodes the null value.
+func (e *Encoder) Null() {
+	e.buf = append(e.buf, majorSimple<<5|simpleNull)
+}
+
+// Raw appends the already encoded data item b.
+func (e *Encoder) Raw(b []byte) {
+	e.buf = append(e.buf, b...)
+}
+
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+type decoder struct {
+	data []byte
+	off  int
+}
+
+func (d *decoder) head() (byte, byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, 0, errTruncated
+	}
+	b := d.data[d.off]
+	d.off++
+	major := b >> 5
+	info := b & 0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: unsupported additional information %d", info)
+	}
+	if len(d.data)-d.off < size {
+		return 0, 0, 0, errTruncated
+	}
+	var n uint64
+	for i := 0; i < size; i++ {
+		n = n<<8 | uint64(d.data[d.off+i])
+	}
+	d.off += size
+	return major, info, n, nil
+}
+
+func (d *decoder) value(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, errors.New("cbor: nesting too deep")
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case majorUint:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return int64(n), nil
+	case majorNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), nil
+	case majorBytes, majorText:
+		if uint64(len(d.data)-d.off) < n {
+			return nil, errTruncated
+		}
+		b := d.data[d.off : d.off+int(n)]
+		d.off += int(n)
+		if major == majorText {
+			return string(b), nil
+		}
+		return append([]byte{}, b...), nil
+	case majorArray:
+		if uint64(len(d.data)-d.off) < n {
+			return nil, errTruncated
+		}
+		a := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case majorMap:
+		if uint64(len(d.data)-d.off) < 2*n {
+			return nil, errTruncated
+		}
+		m := make(Map, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("cbor: unsupported map key type")
+			}
+			if _, ok := m[k]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", k)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case majorTag:
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Tag{Number: n, Content: v}, nil
+	default: // majorSimple
+		switch info {
+		case simpleFalse:
+			return false, nil
+		case simpleTrue:
+			return true, nil
+		case simpleNull:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+// Unmarshal decodes the single CBOR data item in data. Integers are returned
+// as int64, byte strings as []byte, text strings as string, arrays as
+// []interface{}, maps as Map, tags as Tag, and null as nil.
+func Unmarshal(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(data) {
+		return nil, errors.New("cbor: trailing data")
+	}
+	return v, nil
+}
@@ -0,0 +1,88 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	// test vectors from RFC 8949, Appendix A
+	var enc Encoder
+	enc.Int(0)
+	enc.Int(23)
+	enc.Int(24)
+	enc.Int(1000)
+	enc.Int(1000000)
+	enc.Int(-1)
+	enc.Int(-1000)
+	enc.ByteString([]byte{1, 2, 3, 4})
+	enc.TextString("IETF")
+	enc.Array(0)
+	enc.Map(0)
+	enc.Tag(1)
+	enc.Int(1363896240)
+	enc.Null()
+	exp := "00" + "17" + "1818" + "1903e8" + "1a000f4240" + "20" + "3903e7" +
+		"4401020304" + "6449455446" + "80" + "a0" + "c11a514b67b0" + "f6"
+	if h := hex.EncodeToString(enc.Bytes()); h != exp {
+		t.Errorf("encoding differs: %s != %s", h, exp)
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	var enc Encoder
+	enc.Tag(18)
+	enc.Array(4)
+	enc.ByteString([]byte{0xa1, 0x01, 0x27})
+	enc.Map(1)
+	enc.Int(4)
+	enc.TextString("kid")
+	enc.Null()
+	enc.ByteString(make([]byte, 300))
+	v, err := Unmarshal(enc.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag, ok := v.(Tag)
+	if !ok || tag.Number != 18 {
+		t.Fatal("tag expected")
+	}
+	a, ok := tag.Content.([]interface{})
+	if !ok || len(a) != 4 {
+		t.Fatal("array expected")
+	}
+	if b, ok := a[0].([]byte); !ok || !bytes.Equal(b, []byte{0xa1, 0x01, 0x27}) {
+		t.Error("byte string differs")
+	}
+	if m, ok := a[1].(Map); !ok || m[int64(4)] != "kid" {
+		t.Error("map differs")
+	}
+	if a[2] != nil {
+		t.Error("null expected")
+	}
+	if b, ok := a[3].([]byte); !ok || len(b) != 300 {
+		t.Error("byte string differs")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, h := range []string{
+		"",           // empty
+		"1a0000",     // truncated integer
+		"44010203",   // truncated byte string
+		"9bffffffff", // huge array
+		"a20102",     // truncated map
+		"a201020103", // duplicate map key
+		"0000",       // trailing data
+		"f7",         // unsupported simple value
+	} {
+		data, err := hex.DecodeString(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Unmarshal(data); err == nil {
+			t.Errorf("%s: should fail", h)
+		}
+	}
+}
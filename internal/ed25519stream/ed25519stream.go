@@ -0,0 +1,130 @@
+// Package ed25519stream implements Ed25519 (RFC 8032) signing and
+// verification of messages which are read from a stream instead of being
+// kept in memory.
+//
+// The signatures are identical to the ones created by crypto/ed25519 for the
+// same message. Signing reads the message twice, verification once.
+package ed25519stream
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"io"
+
+	"filippo.io/edwards25519"
+)
+
+// ErrMessageChanged is returned by Sign if the message changed between the
+// two passes. No signature is created in this case, because signatures of
+// different messages with the same nonce would reveal the secret key.
+var ErrMessageChanged = errors.New("ed25519stream: message changed while signing")
+
+func bzero(buf []byte) {
+	for i := range buf {
+		buf[i] = 0
+	}
+}
+
+// hashmsg writes head followed by the contents of r to all hashes.
+func hashmsg(head []byte, r io.Reader, hashes ...hash.Hash) error {
+	w := make([]io.Writer, len(hashes))
+	for i, h := range hashes {
+		w[i] = h
+	}
+	mw := io.MultiWriter(w...)
+	if _, err := mw.Write(head); err != nil {
+		return err
+	}
+	_, err := io.Copy(mw, r)
+	return err
+}
+
+// Sign signs the message consisting of head followed by the contents of r,
+// starting at its current offset, with key.
+func Sign(key ed25519.PrivateKey, head []byte, r io.ReadSeeker) ([]byte, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, errors.New("ed25519stream: invalid private key")
+	}
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	h := sha512.Sum512(key[:ed25519.SeedSize])
+	defer bzero(h[:])
+	s, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	if err != nil {
+		return nil, err
+	}
+
+	// first pass: the deterministic nonce r = SHA-512(prefix || M)
+	nh := sha512.New()
+	nh.Write(h[32:])
+	mh := sha512.New()
+	if err := hashmsg(head, r, nh, mh); err != nil {
+		return nil, err
+	}
+	digest := nh.Sum(nil)
+	defer bzero(digest)
+	nonce, err := edwards25519.NewScalar().SetUniformBytes(digest)
+	if err != nil {
+		return nil, err
+	}
+	R := new(edwards25519.Point).ScalarBaseMult(nonce)
+
+	// second pass: the challenge k = SHA-512(R || A || M)
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	kh := sha512.New()
+	kh.Write(R.Bytes())
+	kh.Write(key[ed25519.SeedSize:])
+	mh2 := sha512.New()
+	if err := hashmsg(head, r, kh, mh2); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(mh.Sum(nil), mh2.Sum(nil)) {
+		return nil, ErrMessageChanged
+	}
+	k, err := edwards25519.NewScalar().SetUniformBytes(kh.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	S := edwards25519.NewScalar().MultiplyAdd(k, s, nonce)
+
+	sig := make([]byte, 0, ed25519.SignatureSize)
+	sig = append(sig, R.Bytes()...)
+	return append(sig, S.Bytes()...), nil
+}
+
+// Verify reports whether sig is a valid signature of the message consisting
+// of head followed by the contents of r by the public key pub. An error is
+// only returned if reading r fails.
+func Verify(pub ed25519.PublicKey, head []byte, r io.Reader, sig []byte) (bool, error) {
+	if len(pub) != ed25519.PublicKeySize || len(sig) != ed25519.SignatureSize {
+		return false, nil
+	}
+	A, err := new(edwards25519.Point).SetBytes(pub)
+	if err != nil {
+		return false, nil
+	}
+	kh := sha512.New()
+	kh.Write(sig[:32])
+	kh.Write(pub)
+	if err := hashmsg(head, r, kh); err != nil {
+		return false, err
+	}
+	k, err := edwards25519.NewScalar().SetUniformBytes(kh.Sum(nil))
+	if err != nil {
+		return false, err
+	}
+	S, err := edwards25519.NewScalar().SetCanonicalBytes(sig[32:])
+	if err != nil {
+		return false, nil
+	}
+	minusA := new(edwards25519.Point).Negate(A)
+	R := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(k, minusA, S)
+	return bytes.Equal(sig[:32], R.Bytes()), nil
+}
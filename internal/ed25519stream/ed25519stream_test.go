@@ -0,0 +1,66 @@
+package ed25519stream
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, 63, 64, 65, 100000} {
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(rand.Reader, msg); err != nil {
+			t.Fatal(err)
+		}
+		for _, head := range [][]byte{nil, []byte("head\x00")} {
+			full := append(append([]byte{}, head...), msg...)
+			sig, err := Sign(key, head, bytes.NewReader(msg))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sig, ed25519.Sign(key, full)) {
+				t.Fatalf("size %d: signature differs from crypto/ed25519", size)
+			}
+			ok, err := Verify(pub, head, bytes.NewReader(msg), sig)
+			if err != nil || !ok {
+				t.Fatalf("size %d: verification failed", size)
+			}
+			sig[0] ^= 1
+			if ok, _ := Verify(pub, head, bytes.NewReader(msg), sig); ok {
+				t.Fatalf("size %d: modified signature verified", size)
+			}
+			if ok, _ := Verify(pub, []byte("other"), bytes.NewReader(msg), ed25519.Sign(key, full)); ok {
+				t.Fatalf("size %d: signature verified with other head", size)
+			}
+		}
+	}
+}
+
+// changingReader returns different contents after the first pass.
+type changingReader struct {
+	*bytes.Reader
+}
+
+func (r *changingReader) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		r.Reader = bytes.NewReader([]byte("changed"))
+	}
+	return r.Reader.Seek(offset, whence)
+}
+
+func TestMessageChanged(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &changingReader{Reader: bytes.NewReader([]byte("message"))}
+	if _, err := Sign(key, nil, r); err != ErrMessageChanged {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,641 @@
+// Package frost implements FROST(Ed25519, SHA-512) threshold signatures as
+// specified in RFC 9591 together with a Pedersen distributed key generation.
+//
+// The signatures produced by a threshold of participants are ordinary Ed25519
+// signatures of the group public key.
+package frost
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"filippo.io/edwards25519"
+)
+
+// ContextString is the context string of the ciphersuite FROST-ED25519-SHA512-v1.
+const ContextString = "FROST-ED25519-SHA512-v1"
+
+const (
+	// ScalarSize is the size of a serialized scalar.
+	ScalarSize = 32
+	// ElementSize is the size of a serialized group element.
+	ElementSize = 32
+	// EncryptedShareSize is the size of an encrypted secret share.
+	EncryptedShareSize = ScalarSize + 16
+	// MaxParticipants is the maximum number of participants.
+	MaxParticipants = 255
+)
+
+// Element is a serialized group element.
+type Element [ElementSize]byte
+
+// Scalar is a serialized scalar.
+type Scalar [ScalarSize]byte
+
+// Commitment is the signing commitment of a participant.
+type Commitment struct {
+	ID      uint16
+	Hiding  Element
+	Binding Element
+}
+
+// Nonces are the secret signing nonces of a participant.
+type Nonces struct {
+	Hiding  Scalar
+	Binding Scalar
+}
+
+// SignatureShare is the signature share of a participant.
+type SignatureShare struct {
+	ID    uint16
+	Share Scalar
+}
+
+// DKGSecret is the secret state of a participant between the rounds of the
+// distributed key generation.
+type DKGSecret struct {
+	Coefficients []Scalar // coefficients of the secret polynomial
+	Exchange     Scalar   // secret key to receive secret shares
+}
+
+// DKGPackage is the public package a participant broadcasts in the first
+// round of the distributed key generation.
+type DKGPackage struct {
+	ID          uint16
+	Commitments []Element // commitments to the coefficients
+	ProofR      Element   // proof of knowledge of the constant coefficient
+	ProofZ      Scalar
+	Exchange    Element // public key to receive secret shares
+}
+
+// EncryptedShare is a secret share sent from one participant to another in
+// the second round of the distributed key generation.
+type EncryptedShare struct {
+	From       uint16
+	To         uint16
+	Ciphertext [EncryptedShareSize]byte
+}
+
+func hashToScalar(tag string, m ...[]byte) *edwards25519.Scalar {
+	h := sha512.New()
+	if tag != "" {
+		h.Write([]byte(ContextString))
+		h.Write([]byte(tag))
+	}
+	for _, b := range m {
+		h.Write(b)
+	}
+	s, err := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		panic(err) // cannot happen
+	}
+	return s
+}
+
+func h4(m []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte(ContextString + "msg"))
+	h.Write(m)
+	return h.Sum(nil)
+}
+
+func h5(m []byte) []byte {
+	h := sha512.New()
+	h.Write([]byte(ContextString + "com"))
+	h.Write(m)
+	return h.Sum(nil)
+}
+
+// identifier returns the scalar of the participant identifier id.
+func identifier(id uint16) *edwards25519.Scalar {
+	var b [ScalarSize]byte
+	binary.LittleEndian.PutUint16(b[:], id)
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(b[:])
+	if err != nil {
+		panic(err) // cannot happen
+	}
+	return s
+}
+
+// invert returns 1/x by computing x^(l-2).
+func invert(x *edwards25519.Scalar) *edwards25519.Scalar {
+	// l-2 in little-endian byte order
+	e := [32]byte{
+		0xeb, 0xd3, 0xf5, 0x5c, 0x1a, 0x63, 0x12, 0x58,
+		0xd6, 0x9c, 0xf7, 0xa2, 0xde, 0xf9, 0xde, 0x14,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10,
+	}
+	r := identifier(1)
+	for i := 255; i >= 0; i-- {
+		r.Multiply(r, r)
+		if e[i/8]>>(uint(i)%8)&1 == 1 {
+			r.Multiply(r, x)
+		}
+	}
+	return r
+}
+
+func randomScalar(rand io.Reader, secret ...[]byte) (*edwards25519.Scalar, error) {
+	var b [32]byte
+	if _, err := io.ReadFull(rand, b[:]); err != nil {
+		return nil, err
+	}
+	return hashToScalar("nonce", append([][]byte{b[:]}, secret...)...), nil
+}
+
+func parseScalar(b Scalar) (*edwards25519.Scalar, error) {
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(b[:])
+	if err != nil {
+		return nil, errors.New("frost: invalid scalar")
+	}
+	return s, nil
+}
+
+// parseElement parses b and makes sure it is not the identity element.
+func parseElement(b Element) (*edwards25519.Point, error) {
+	p, err := new(edwards25519.Point).SetBytes(b[:])
+	if err != nil || p.Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, errors.New("frost: invalid element")
+	}
+	return p, nil
+}
+
+func scalarBytes(s *edwards25519.Scalar) Scalar {
+	var b Scalar
+	copy(b[:], s.Bytes())
+	return b
+}
+
+func elementBytes(p *edwards25519.Point) Element {
+	var b Element
+	copy(b[:], p.Bytes())
+	return b
+}
+
+// PublicKey returns the public key of the secret share or key s.
+func PublicKey(s Scalar) (Element, error) {
+	x, err := parseScalar(s)
+	if err != nil {
+		return Element{}, err
+	}
+	return elementBytes(new(edwards25519.Point).ScalarBaseMult(x)), nil
+}
+
+// checkParams checks the threshold t and the number of participants n.
+func checkParams(t, n int) error {
+	if n < 2 || n > MaxParticipants {
+		return fmt.Errorf("frost: number of participants not in range 2..%d", MaxParticipants)
+	}
+	if t < 2 || t > n {
+		return fmt.Errorf("frost: threshold not in range 2..%d", n)
+	}
+	return nil
+}
+
+// dkgChallenge returns the challenge of the proof of knowledge of the
+// constant coefficient of participant id.
+func dkgChallenge(id uint16, t, n int, c0, exchange, r Element) *edwards25519.Scalar {
+	var params [6]byte
+	binary.BigEndian.PutUint16(params[0:], id)
+	binary.BigEndian.PutUint16(params[2:], uint16(t))
+	binary.BigEndian.PutUint16(params[4:], uint16(n))
+	return hashToScalar("dkg", params[:], c0[:], exchange[:], r[:])
+}
+
+// DKGRound1 starts the distributed key generation for participant id of n
+// participants with threshold t. The returned secret must be kept until the
+// last round, the package must be sent to all other participants.
+func DKGRound1(rand io.Reader, id uint16, t, n int) (*DKGSecret, *DKGPackage, error) {
+	if err := checkParams(t, n); err != nil {
+		return nil, nil, err
+	}
+	if id < 1 || int(id) > n {
+		return nil, nil, fmt.Errorf("frost: participant identifier not in range 1..%d", n)
+	}
+	secret := &DKGSecret{Coefficients: make([]Scalar, t)}
+	pkg := &DKGPackage{ID: id, Commitments: make([]Element, t)}
+	var a0 *edwards25519.Scalar
+	for i := range secret.Coefficients {
+		a, err := randomScalar(rand)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i == 0 {
+			a0 = a
+		}
+		secret.Coefficients[i] = scalarBytes(a)
+		pkg.Commitments[i] = elementBytes(new(edwards25519.Point).ScalarBaseMult(a))
+	}
+	e, err := randomScalar(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret.Exchange = scalarBytes(e)
+	pkg.Exchange = elementBytes(new(edwards25519.Point).ScalarBaseMult(e))
+	k, err := randomScalar(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg.ProofR = elementBytes(new(edwards25519.Point).ScalarBaseMult(k))
+	c := dkgChallenge(id, t, n, pkg.Commitments[0], pkg.Exchange, pkg.ProofR)
+	pkg.ProofZ = scalarBytes(edwards25519.NewScalar().MultiplyAdd(a0, c, k))
+	return secret, pkg, nil
+}
+
+// verifyPackage verifies the proof of knowledge of pkg.
+func verifyPackage(pkg *DKGPackage, t, n int) error {
+	if len(pkg.Commitments) != t {
+		return fmt.Errorf("frost: package of participant %d has wrong threshold", pkg.ID)
+	}
+	for _, c := range pkg.Commitments {
+		if _, err := parseElement(c); err != nil {
+			return err
+		}
+	}
+	c0, err := parseElement(pkg.Commitments[0])
+	if err != nil {
+		return err
+	}
+	if _, err := parseElement(pkg.Exchange); err != nil {
+		return err
+	}
+	r, err := parseElement(pkg.ProofR)
+	if err != nil {
+		return err
+	}
+	z, err := parseScalar(pkg.ProofZ)
+	if err != nil {
+		return err
+	}
+	// R == z*G - c*C0
+	c := dkgChallenge(pkg.ID, t, n, pkg.Commitments[0], pkg.Exchange, pkg.ProofR)
+	c.Negate(c)
+	if new(edwards25519.Point).VarTimeDoubleScalarBaseMult(c, c0, z).Equal(r) != 1 {
+		return fmt.Errorf("frost: invalid proof of knowledge of participant %d", pkg.ID)
+	}
+	return nil
+}
+
+// checkPackages makes sure that pkgs contains the valid packages of all n
+// participants, including the one of participant id which must belong to
+// secret. The packages are returned sorted by participant identifier.
+func checkPackages(secret *DKGSecret, id uint16, pkgs []*DKGPackage) ([]*DKGPackage, error) {
+	t := len(secret.Coefficients)
+	n := len(pkgs)
+	if err := checkParams(t, n); err != nil {
+		return nil, err
+	}
+	sorted := make([]*DKGPackage, n)
+	for _, pkg := range pkgs {
+		if pkg.ID < 1 || int(pkg.ID) > n {
+			return nil, fmt.Errorf("frost: participant identifier %d not in range 1..%d", pkg.ID, n)
+		}
+		if sorted[pkg.ID-1] != nil {
+			return nil, fmt.Errorf("frost: duplicate package of participant %d", pkg.ID)
+		}
+		if err := verifyPackage(pkg, t, n); err != nil {
+			return nil, err
+		}
+		sorted[pkg.ID-1] = pkg
+	}
+	if id < 1 || int(id) > n {
+		return nil, fmt.Errorf("frost: participant identifier not in range 1..%d", n)
+	}
+	a0, err := PublicKey(secret.Coefficients[0])
+	if err != nil {
+		return nil, err
+	}
+	if sorted[id-1].Commitments[0] != a0 {
+		return nil, errors.New("frost: own package does not match secret")
+	}
+	return sorted, nil
+}
+
+// evaluate evaluates the polynomial with the given coefficients at x.
+func evaluate(coefficients []Scalar, x *edwards25519.Scalar) (*edwards25519.Scalar, error) {
+	r := edwards25519.NewScalar()
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		a, err := parseScalar(coefficients[i])
+		if err != nil {
+			return nil, err
+		}
+		r.MultiplyAdd(r, x, a)
+	}
+	return r, nil
+}
+
+// evaluateCommitments evaluates the committed polynomial at x.
+func evaluateCommitments(commitments []Element, x *edwards25519.Scalar) (*edwards25519.Point, error) {
+	r := edwards25519.NewIdentityPoint()
+	for i := len(commitments) - 1; i >= 0; i-- {
+		c, err := parseElement(commitments[i])
+		if err != nil {
+			return nil, err
+		}
+		r.ScalarMult(x, r)
+		r.Add(r, c)
+	}
+	return r, nil
+}
+
+// shareCipher returns the AEAD used to encrypt the secret share from
+// participant from to participant to.
+func shareCipher(secret Scalar, public Element, from, to uint16) (cipher.AEAD, error) {
+	e, err := parseScalar(secret)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parseElement(public)
+	if err != nil {
+		return nil, err
+	}
+	dh := new(edwards25519.Point).ScalarMult(e, p)
+	var ids [4]byte
+	binary.BigEndian.PutUint16(ids[0:], from)
+	binary.BigEndian.PutUint16(ids[2:], to)
+	h := sha512.New()
+	h.Write([]byte(ContextString + "share"))
+	h.Write(dh.Bytes())
+	h.Write(ids[:])
+	block, err := aes.NewCipher(h.Sum(nil)[:32])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// DKGRound2 verifies the packages of all participants (including the own one)
+// and returns the encrypted secret shares for the other participants.
+func DKGRound2(secret *DKGSecret, id uint16, pkgs []*DKGPackage) ([]EncryptedShare, error) {
+	sorted, err := checkPackages(secret, id, pkgs)
+	if err != nil {
+		return nil, err
+	}
+	var shares []EncryptedShare
+	var nonce [12]byte // every key is only used once
+	for _, pkg := range sorted {
+		if pkg.ID == id {
+			continue
+		}
+		s, err := evaluate(secret.Coefficients, identifier(pkg.ID))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := shareCipher(secret.Exchange, pkg.Exchange, id, pkg.ID)
+		if err != nil {
+			return nil, err
+		}
+		share := EncryptedShare{From: id, To: pkg.ID}
+		aead.Seal(share.Ciphertext[:0], nonce[:], s.Bytes(), nil)
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// DKGRound3 verifies the secret shares sent to participant id and returns its
+// secret signing share and the group public key. shares may contain shares
+// for other participants, which are ignored.
+func DKGRound3(secret *DKGSecret, id uint16, pkgs []*DKGPackage, shares []EncryptedShare) (Scalar, Element, error) {
+	sorted, err := checkPackages(secret, id, pkgs)
+	if err != nil {
+		return Scalar{}, Element{}, err
+	}
+	x := identifier(id)
+	s, err := evaluate(secret.Coefficients, x)
+	if err != nil {
+		return Scalar{}, Element{}, err
+	}
+	received := make(map[uint16]bool)
+	var nonce [12]byte
+	for _, share := range shares {
+		if share.To != id {
+			continue
+		}
+		if share.From < 1 || int(share.From) > len(sorted) || share.From == id {
+			return Scalar{}, Element{}, fmt.Errorf("frost: share from unknown participant %d", share.From)
+		}
+		if received[share.From] {
+			return Scalar{}, Element{}, fmt.Errorf("frost: duplicate share from participant %d", share.From)
+		}
+		pkg := sorted[share.From-1]
+		aead, err := shareCipher(secret.Exchange, pkg.Exchange, share.From, id)
+		if err != nil {
+			return Scalar{}, Element{}, err
+		}
+		b, err := aead.Open(nil, nonce[:], share.Ciphertext[:], nil)
+		if err != nil {
+			return Scalar{}, Element{}, fmt.Errorf("frost: cannot decrypt share from participant %d", share.From)
+		}
+		var sb Scalar
+		copy(sb[:], b)
+		f, err := parseScalar(sb)
+		if err != nil {
+			return Scalar{}, Element{}, err
+		}
+		// f*G == sum_k C_k * x^k
+		exp, err := evaluateCommitments(pkg.Commitments, x)
+		if err != nil {
+			return Scalar{}, Element{}, err
+		}
+		if new(edwards25519.Point).ScalarBaseMult(f).Equal(exp) != 1 {
+			return Scalar{}, Element{}, fmt.Errorf("frost: invalid share from participant %d", share.From)
+		}
+		s.Add(s, f)
+		received[share.From] = true
+	}
+	if len(received) != len(sorted)-1 {
+		return Scalar{}, Element{}, errors.New("frost: missing shares")
+	}
+	y := edwards25519.NewIdentityPoint()
+	for _, pkg := range sorted {
+		c0, err := parseElement(pkg.Commitments[0])
+		if err != nil {
+			return Scalar{}, Element{}, err
+		}
+		y.Add(y, c0)
+	}
+	return scalarBytes(s), elementBytes(y), nil
+}
+
+// Commit generates the nonces and the commitment for one signing operation
+// with the secret signing share share. The nonces must only be used once.
+func Commit(rand io.Reader, id uint16, share Scalar) (*Nonces, *Commitment, error) {
+	hiding, err := randomScalar(rand, share[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	binding, err := randomScalar(rand, share[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	nonces := &Nonces{Hiding: scalarBytes(hiding), Binding: scalarBytes(binding)}
+	commitment := &Commitment{
+		ID:      id,
+		Hiding:  elementBytes(new(edwards25519.Point).ScalarBaseMult(hiding)),
+		Binding: elementBytes(new(edwards25519.Point).ScalarBaseMult(binding)),
+	}
+	return nonces, commitment, nil
+}
+
+// sortCommitments returns the commitments sorted by participant identifier
+// and makes sure that they are unique.
+func sortCommitments(commitments []Commitment) ([]Commitment, error) {
+	sorted := append([]Commitment(nil), commitments...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	for i, c := range sorted {
+		if c.ID < 1 || c.ID > MaxParticipants {
+			return nil, fmt.Errorf("frost: invalid participant identifier %d", c.ID)
+		}
+		if i > 0 && sorted[i-1].ID == c.ID {
+			return nil, fmt.Errorf("frost: duplicate commitment of participant %d", c.ID)
+		}
+	}
+	return sorted, nil
+}
+
+// bindingFactors computes the binding factors of all commitments.
+func bindingFactors(groupkey Element, commitments []Commitment, msg []byte) map[uint16]*edwards25519.Scalar {
+	var list []byte
+	for _, c := range commitments {
+		list = append(list, identifier(c.ID).Bytes()...)
+		list = append(list, c.Hiding[:]...)
+		list = append(list, c.Binding[:]...)
+	}
+	prefix := append(append(groupkey[:], h4(msg)...), h5(list)...)
+	factors := make(map[uint16]*edwards25519.Scalar)
+	for _, c := range commitments {
+		factors[c.ID] = hashToScalar("rho", prefix, identifier(c.ID).Bytes())
+	}
+	return factors
+}
+
+// groupCommitment computes the group commitment R.
+func groupCommitment(commitments []Commitment, factors map[uint16]*edwards25519.Scalar) (*edwards25519.Point, error) {
+	r := edwards25519.NewIdentityPoint()
+	for _, c := range commitments {
+		d, err := parseElement(c.Hiding)
+		if err != nil {
+			return nil, err
+		}
+		e, err := parseElement(c.Binding)
+		if err != nil {
+			return nil, err
+		}
+		r.Add(r, d)
+		r.Add(r, new(edwards25519.Point).ScalarMult(factors[c.ID], e))
+	}
+	return r, nil
+}
+
+// lagrange computes the Lagrange coefficient of participant id.
+func lagrange(id uint16, commitments []Commitment) *edwards25519.Scalar {
+	x := identifier(id)
+	num := identifier(1)
+	den := identifier(1)
+	for _, c := range commitments {
+		if c.ID == id {
+			continue
+		}
+		xj := identifier(c.ID)
+		num.Multiply(num, xj)
+		den.Multiply(den, edwards25519.NewScalar().Subtract(xj, x))
+	}
+	return num.Multiply(num, invert(den))
+}
+
+// challenge computes the Ed25519 challenge H2(R || Y || msg).
+func challenge(r *edwards25519.Point, groupkey Element, msg []byte) *edwards25519.Scalar {
+	return hashToScalar("", r.Bytes(), groupkey[:], msg)
+}
+
+// Sign computes the signature share of participant id with secret signing
+// share share for msg, given the commitments of all signing participants.
+func Sign(id uint16, share Scalar, groupkey Element, nonces *Nonces, commitments []Commitment, msg []byte) (*SignatureShare, error) {
+	sorted, err := sortCommitments(commitments)
+	if err != nil {
+		return nil, err
+	}
+	hiding, err := parseScalar(nonces.Hiding)
+	if err != nil {
+		return nil, err
+	}
+	binding, err := parseScalar(nonces.Binding)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseScalar(share)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	for _, c := range sorted {
+		if c.ID != id {
+			continue
+		}
+		if c.Hiding != elementBytes(new(edwards25519.Point).ScalarBaseMult(hiding)) ||
+			c.Binding != elementBytes(new(edwards25519.Point).ScalarBaseMult(binding)) {
+			return nil, errors.New("frost: own commitment does not match nonces")
+		}
+		found = true
+	}
+	if !found {
+		return nil, errors.New("frost: own commitment missing")
+	}
+	factors := bindingFactors(groupkey, sorted, msg)
+	r, err := groupCommitment(sorted, factors)
+	if err != nil {
+		return nil, err
+	}
+	c := challenge(r, groupkey, msg)
+	l := lagrange(id, sorted)
+	// z = d + e*rho + lambda*s*c
+	z := edwards25519.NewScalar().MultiplyAdd(binding, factors[id], hiding)
+	z.MultiplyAdd(l.Multiply(l, s), c, z)
+	return &SignatureShare{ID: id, Share: scalarBytes(z)}, nil
+}
+
+// Aggregate combines the signature shares of all signing participants into
+// an Ed25519 signature of msg and verifies it.
+func Aggregate(groupkey Element, commitments []Commitment, shares []SignatureShare, msg []byte) ([]byte, error) {
+	sorted, err := sortCommitments(commitments)
+	if err != nil {
+		return nil, err
+	}
+	if len(shares) != len(sorted) {
+		return nil, errors.New("frost: number of signature shares and commitments differ")
+	}
+	factors := bindingFactors(groupkey, sorted, msg)
+	r, err := groupCommitment(sorted, factors)
+	if err != nil {
+		return nil, err
+	}
+	z := edwards25519.NewScalar()
+	seen := make(map[uint16]bool)
+	for _, share := range shares {
+		if _, ok := factors[share.ID]; !ok {
+			return nil, fmt.Errorf("frost: no commitment of participant %d", share.ID)
+		}
+		if seen[share.ID] {
+			return nil, fmt.Errorf("frost: duplicate signature share of participant %d", share.ID)
+		}
+		seen[share.ID] = true
+		s, err := parseScalar(share.Share)
+		if err != nil {
+			return nil, err
+		}
+		z.Add(z, s)
+	}
+	sig := append(r.Bytes(), z.Bytes()...)
+	if !ed25519.Verify(groupkey[:], msg, sig) {
+		return nil, errors.New("frost: invalid signature share")
+	}
+	return sig, nil
+}
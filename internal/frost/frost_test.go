@@ -0,0 +1,123 @@
+package frost
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"filippo.io/edwards25519"
+)
+
+func TestInvert(t *testing.T) {
+	x := identifier(12345)
+	if invert(x).Multiply(invert(x), x).Equal(identifier(1)) != 1 {
+		t.Error("x * 1/x != 1")
+	}
+}
+
+// dkg runs the distributed key generation for n participants with threshold
+// t and returns the signing shares and the group public key.
+func dkg(t *testing.T, threshold, n int) ([]Scalar, Element) {
+	secrets := make([]*DKGSecret, n)
+	pkgs := make([]*DKGPackage, n)
+	for i := range secrets {
+		var err error
+		secrets[i], pkgs[i], err = DKGRound1(rand.Reader, uint16(i+1), threshold, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var shares []EncryptedShare
+	for i, secret := range secrets {
+		s, err := DKGRound2(secret, uint16(i+1), pkgs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares = append(shares, s...)
+	}
+	signing := make([]Scalar, n)
+	var groupkey Element
+	for i, secret := range secrets {
+		s, y, err := DKGRound3(secret, uint16(i+1), pkgs, shares)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && y != groupkey {
+			t.Fatal("group public keys differ")
+		}
+		signing[i] = s
+		groupkey = y
+	}
+	return signing, groupkey
+}
+
+func sign(t *testing.T, signing []Scalar, groupkey Element, ids []uint16, msg []byte) ([]byte, error) {
+	nonces := make([]*Nonces, len(ids))
+	var commitments []Commitment
+	for i, id := range ids {
+		n, c, err := Commit(rand.Reader, id, signing[id-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonces[i] = n
+		commitments = append(commitments, *c)
+	}
+	var shares []SignatureShare
+	for i, id := range ids {
+		s, err := Sign(id, signing[id-1], groupkey, nonces[i], commitments, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		shares = append(shares, *s)
+	}
+	return Aggregate(groupkey, commitments, shares, msg)
+}
+
+func TestFROST(t *testing.T) {
+	signing, groupkey := dkg(t, 2, 3)
+	msg := []byte("test message")
+	for _, ids := range [][]uint16{{1, 2}, {2, 3}, {3, 1}, {1, 2, 3}} {
+		sig, err := sign(t, signing, groupkey, ids, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ed25519.Verify(groupkey[:], msg, sig) {
+			t.Errorf("signature of %v does not verify", ids)
+		}
+	}
+	// the shares interpolate to the secret key of the group public key
+	sum := edwards25519.NewScalar()
+	ids := []Commitment{{ID: 1}, {ID: 3}}
+	for _, c := range ids {
+		s, _ := parseScalar(signing[c.ID-1])
+		sum.Add(sum, s.Multiply(s, lagrange(c.ID, ids)))
+	}
+	if y := elementBytes(new(edwards25519.Point).ScalarBaseMult(sum)); y != groupkey {
+		t.Error("shares do not interpolate to group key")
+	}
+	// a single participant cannot sign
+	if _, err := sign(t, signing, groupkey, []uint16{1}, msg); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestDKGTampered(t *testing.T) {
+	secret, pkg, err := DKGRound1(rand.Reader, 1, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, other, err := DKGRound1(rand.Reader, 2, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Commitments[0] = pkg.Commitments[0]
+	if _, err := DKGRound2(secret, 1, []*DKGPackage{pkg, other}); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := DKGRound2(secret, 1, []*DKGPackage{pkg}); err == nil {
+		t.Error("should fail")
+	}
+	if _, _, err := DKGRound1(rand.Reader, 3, 2, 2); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,65 @@
+// Package pkcs11uri parses PKCS#11 URIs as specified in RFC 7512.
+package pkcs11uri
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Scheme is the URI scheme of PKCS#11 URIs, including the colon.
+const Scheme = "pkcs11:"
+
+// URI is a parsed PKCS#11 URI.
+type URI struct {
+	// Path contains the path attributes (like token, object, and id), which
+	// identify the object.
+	Path map[string]string
+	// Query contains the query attributes (like module-path and pin-value),
+	// which specify how to access the object.
+	Query map[string]string
+}
+
+func parseattrs(s, sep string, attrs map[string]string) error {
+	if s == "" {
+		return nil
+	}
+	for _, attr := range strings.Split(s, sep) {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("pkcs11uri: invalid attribute %q", attr)
+		}
+		if _, ok := attrs[kv[0]]; ok {
+			return fmt.Errorf("pkcs11uri: duplicate attribute %q", kv[0])
+		}
+		v, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return fmt.Errorf("pkcs11uri: invalid attribute %q", attr)
+		}
+		attrs[kv[0]] = v
+	}
+	return nil
+}
+
+// Parse parses the PKCS#11 URI s.
+func Parse(s string) (*URI, error) {
+	if !strings.HasPrefix(s, Scheme) {
+		return nil, errors.New("pkcs11uri: not a PKCS#11 URI")
+	}
+	s = strings.TrimPrefix(s, Scheme)
+	u := &URI{
+		Path:  make(map[string]string),
+		Query: make(map[string]string),
+	}
+	parts := strings.SplitN(s, "?", 2)
+	if err := parseattrs(parts[0], ";", u.Path); err != nil {
+		return nil, err
+	}
+	if len(parts) == 2 {
+		if err := parseattrs(parts[1], "&", u.Query); err != nil {
+			return nil, err
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,46 @@
+package pkcs11uri
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	u, err := Parse("pkcs11:token=release%20keys;object=signify;id=%01%02" +
+		"?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path["token"] != "release keys" {
+		t.Errorf("wrong token: %q", u.Path["token"])
+	}
+	if u.Path["object"] != "signify" {
+		t.Errorf("wrong object: %q", u.Path["object"])
+	}
+	if u.Path["id"] != "\x01\x02" {
+		t.Errorf("wrong id: %q", u.Path["id"])
+	}
+	if u.Query["module-path"] != "/usr/lib/softhsm/libsofthsm2.so" {
+		t.Errorf("wrong module-path: %q", u.Query["module-path"])
+	}
+	if u.Query["pin-value"] != "1234" {
+		t.Errorf("wrong pin-value: %q", u.Query["pin-value"])
+	}
+	if _, err := Parse("pkcs11:"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"file:key.sec",
+		"pkcs11:token",
+		"pkcs11:=foo",
+		"pkcs11:token=a;token=b",
+		"pkcs11:object=%zz",
+		"pkcs11:object=a?pin-value",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%s: should fail", s)
+		}
+	}
+}
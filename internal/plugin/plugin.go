@@ -0,0 +1,170 @@
+// Package plugin implements the protocol between gosignify and external signer
+// plugins.
+//
+// For the secret key plugin:NAME:DATA gosignify starts the executable
+// gosignify-plugin-NAME (found in $PATH) and exchanges newline terminated
+// lines over the standard input and output of the plugin. Every line consists
+// of a command and its arguments separated by single spaces. All arguments are
+// base64 encoded (standard encoding without padding).
+//
+//	gosignify -> plugin: hello VERSION DATA
+//	plugin -> gosignify: key KEYNUM PUBKEY COMMENT
+//	gosignify -> plugin: sign MESSAGE
+//	plugin -> gosignify: sig SIGNATURE
+//	...
+//	gosignify -> plugin: bye
+//
+// KEYNUM is the 8-byte key number, PUBKEY the 32-byte Ed25519 public key, and
+// SIGNATURE the 64-byte Ed25519 signature of MESSAGE. Instead of key or sig
+// the plugin can answer with "error MESSAGE", after which gosignify stops the
+// plugin. Plugins must not use standard input and output for anything else;
+// they can interact with the user via standard error or the terminal.
+package plugin
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Version is the protocol version.
+const Version = "1"
+
+// Prefix is the prefix of plugin executables.
+const Prefix = "gosignify-plugin-"
+
+// Commands.
+const (
+	CmdHello = "hello"
+	CmdKey   = "key"
+	CmdSign  = "sign"
+	CmdSig   = "sig"
+	CmdError = "error"
+	CmdBye   = "bye"
+)
+
+// KeynumSize is the size of a key number.
+const KeynumSize = 8
+
+var enc = base64.RawStdEncoding
+
+// Conn is one end of a plugin connection.
+type Conn struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// NewConn returns a new connection which reads from r and writes to w.
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+// Send sends the command cmd with the given arguments.
+func (c *Conn) Send(cmd string, args ...[]byte) error {
+	line := []string{cmd}
+	for _, arg := range args {
+		line = append(line, enc.EncodeToString(arg))
+	}
+	_, err := io.WriteString(c.w, strings.Join(line, " ")+"\n")
+	return err
+}
+
+// Receive receives a command and its arguments.
+func (c *Conn) Receive() (string, [][]byte, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			return "", nil, io.ErrUnexpectedEOF
+		}
+		return "", nil, err
+	}
+	fields := strings.Split(strings.TrimSuffix(line, "\n"), " ")
+	var args [][]byte
+	for _, field := range fields[1:] {
+		arg, err := enc.DecodeString(field)
+		if err != nil {
+			return "", nil, fmt.Errorf("plugin: invalid argument in %s command", fields[0])
+		}
+		args = append(args, arg)
+	}
+	return fields[0], args, nil
+}
+
+// Expect receives the command cmd with n arguments. If an error command is
+// received instead, it is returned as error.
+func (c *Conn) Expect(cmd string, n int) ([][]byte, error) {
+	got, args, err := c.Receive()
+	if err != nil {
+		return nil, err
+	}
+	if got == CmdError && len(args) == 1 {
+		return nil, errors.New(string(args[0]))
+	}
+	if got != cmd || len(args) != n {
+		return nil, fmt.Errorf("plugin: expected %s command", cmd)
+	}
+	return args, nil
+}
+
+// Signer is the secret key of a plugin.
+type Signer interface {
+	// Keynum returns the key number of the key.
+	Keynum() [KeynumSize]byte
+	// PublicKey returns the public key of the key.
+	PublicKey() ed25519.PublicKey
+	// Comment returns a comment describing the key.
+	Comment() string
+	// Sign signs msg with the key.
+	Sign(msg []byte) ([]byte, error)
+}
+
+// Serve implements the plugin side of the protocol on r and w. open is called
+// with the DATA of the hello command and must return the Signer for it.
+func Serve(r io.Reader, w io.Writer, open func(data string) (Signer, error)) error {
+	c := NewConn(r, w)
+	args, err := c.Expect(CmdHello, 2)
+	if err != nil {
+		return err
+	}
+	if string(args[0]) != Version {
+		c.Send(CmdError, []byte("unsupported protocol version"))
+		return fmt.Errorf("plugin: unsupported protocol version %s", args[0])
+	}
+	s, err := open(string(args[1]))
+	if err != nil {
+		c.Send(CmdError, []byte(err.Error()))
+		return err
+	}
+	keynum := s.Keynum()
+	if err := c.Send(CmdKey, keynum[:], s.PublicKey(), []byte(s.Comment())); err != nil {
+		return err
+	}
+	for {
+		cmd, args, err := c.Receive()
+		if err != nil {
+			return err
+		}
+		switch {
+		case cmd == CmdBye:
+			return nil
+		case cmd == CmdSign && len(args) == 1:
+			sig, err := s.Sign(args[0])
+			if err != nil {
+				if err := c.Send(CmdError, []byte(err.Error())); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := c.Send(CmdSig, sig); err != nil {
+				return err
+			}
+		default:
+			c.Send(CmdError, []byte("unknown command"))
+			return fmt.Errorf("plugin: unknown command %s", cmd)
+		}
+	}
+}
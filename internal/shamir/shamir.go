@@ -0,0 +1,107 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8), byte by
+// byte. The arithmetic does not branch on or index memory by secret data.
+package shamir
+
+import (
+	"errors"
+	"io"
+)
+
+// Share is a share of a secret. Index is the nonzero x coordinate at which
+// the polynomials are evaluated and Data holds one evaluation per byte of the
+// secret.
+type Share struct {
+	Index byte
+	Data  []byte
+}
+
+// mul multiplies a and b in GF(2^8) with the AES polynomial.
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= a & -(b & 1)
+		hi := -(a >> 7)
+		a = a<<1 ^ 0x1b&hi
+		b >>= 1
+	}
+	return p
+}
+
+// inv returns the inverse of a in GF(2^8), which is a^254.
+func inv(a byte) byte {
+	r := a
+	for i := 0; i < 6; i++ {
+		r = mul(mul(r, r), a)
+	}
+	return mul(r, r)
+}
+
+// Split splits secret into n shares, any k of which recover it. The shares
+// have the indices 1 to n. The coefficients are read from rand.
+func Split(secret []byte, n, k int, rand io.Reader) ([]Share, error) {
+	if k < 1 || k > n || n > 255 {
+		return nil, errors.New("shamir: invalid threshold or number of shares")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("shamir: empty secret")
+	}
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i].Index = byte(i + 1)
+		shares[i].Data = make([]byte, len(secret))
+	}
+	coeffs := make([]byte, k)
+	defer func() {
+		for i := range coeffs {
+			coeffs[i] = 0
+		}
+	}()
+	for j, s := range secret {
+		coeffs[0] = s
+		if _, err := io.ReadFull(rand, coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range shares {
+			// Horner's method
+			var y byte
+			for c := k - 1; c >= 0; c-- {
+				y = mul(y, shares[i].Index) ^ coeffs[c]
+			}
+			shares[i].Data[j] = y
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from shares, which must be at least as many as
+// the threshold used for splitting. Too few shares result in a wrong secret.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("shamir: no shares")
+	}
+	size := len(shares[0].Data)
+	for i, s := range shares {
+		if s.Index == 0 || len(s.Data) != size {
+			return nil, errors.New("shamir: invalid share")
+		}
+		for _, t := range shares[:i] {
+			if s.Index == t.Index {
+				return nil, errors.New("shamir: duplicate share")
+			}
+		}
+	}
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size)
+	for i, s := range shares {
+		basis := byte(1)
+		for j, t := range shares {
+			if i != j {
+				basis = mul(basis, mul(t.Index, inv(s.Index^t.Index)))
+			}
+		}
+		for b := range secret {
+			secret[b] ^= mul(basis, s.Data[b])
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,56 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestMul(t *testing.T) {
+	// FIPS 197, section 4.2
+	if p := mul(0x57, 0x83); p != 0xc1 {
+		t.Errorf("0x57 * 0x83 = %#x", p)
+	}
+	for a := 1; a < 256; a++ {
+		if p := mul(byte(a), inv(byte(a))); p != 1 {
+			t.Fatalf("%#x * inv(%#x) = %#x", a, a, p)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		t.Fatal(err)
+	}
+	shares, err := Split(secret, 5, 3, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var s []Share
+		for _, i := range subset {
+			s = append(s, shares[i])
+		}
+		got, err := Combine(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("shares %v: wrong secret", subset)
+		}
+	}
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Error("two shares should not suffice")
+	}
+	if _, err := Combine([]Share{shares[0], shares[0]}); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := Split(secret, 3, 4, rand.Reader); err == nil {
+		t.Error("should fail")
+	}
+}
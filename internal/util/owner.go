@@ -0,0 +1,9 @@
+package util
+
+import (
+	"errors"
+)
+
+// ErrOwnerUnsupported is returned by FileUID on platforms which do not
+// support retrieving the owner of a file.
+var ErrOwnerUnsupported = errors.New("file owners not supported on this platform")
@@ -0,0 +1,17 @@
+// +build !windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileUID returns the user ID of the owner of the file described by fi.
+func FileUID(fi os.FileInfo) (int, error) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, ErrOwnerUnsupported
+	}
+	return int(st.Uid), nil
+}
@@ -0,0 +1,10 @@
+package util
+
+import (
+	"os"
+)
+
+// FileUID returns the user ID of the owner of the file described by fi.
+func FileUID(fi os.FileInfo) (int, error) {
+	return -1, ErrOwnerUnsupported
+}
@@ -0,0 +1,9 @@
+package util
+
+import (
+	"errors"
+)
+
+// ErrPeerCredUnsupported is returned by PeerUID on platforms which do not
+// support retrieving the credentials of a socket peer.
+var ErrPeerCredUnsupported = errors.New("peer credentials not supported on this platform")
@@ -0,0 +1,26 @@
+// +build dragonfly netbsd openbsd
+// +build cgo
+
+package util
+
+/*
+#include <sys/types.h>
+#include <unistd.h>
+*/
+import "C"
+
+// PeerCredSupported tells whether PeerUID is supported on this platform.
+const PeerCredSupported = true
+
+// PeerUID returns the user ID of the process connected to the unix domain
+// socket fd.
+func PeerUID(fd uintptr) (int, error) {
+	var (
+		uid C.uid_t
+		gid C.gid_t
+	)
+	if rc, err := C.getpeereid(C.int(fd), &uid, &gid); rc != 0 {
+		return -1, err
+	}
+	return int(uid), nil
+}
@@ -0,0 +1,18 @@
+package util
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// PeerCredSupported tells whether PeerUID is supported on this platform.
+const PeerCredSupported = true
+
+// PeerUID returns the user ID of the process connected to the unix domain
+// socket fd.
+func PeerUID(fd uintptr) (int, error) {
+	cred, err := unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return -1, err
+	}
+	return int(cred.Uid), nil
+}
@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!freebsd
+// +build !dragonfly,!netbsd,!openbsd !cgo
+
+package util
+
+// PeerCredSupported tells whether PeerUID is supported on this platform.
+const PeerCredSupported = false
+
+// PeerUID returns the user ID of the process connected to the unix domain
+// socket fd.
+func PeerUID(fd uintptr) (int, error) {
+	return -1, ErrPeerCredUnsupported
+}
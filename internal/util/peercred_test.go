@@ -0,0 +1,53 @@
+package util
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPeerUID(t *testing.T) {
+	if !PeerCredSupported {
+		t.Skip("peer credentials not supported on this platform")
+	}
+	tmpdir, err := ioutil.TempDir("", "util")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	l, err := net.Listen("unix", filepath.Join(tmpdir, "sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := net.Dial("unix", filepath.Join(tmpdir, "sock")); err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	rc, err := conn.(*net.UnixConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		uid     int
+		peererr error
+	)
+	if err := rc.Control(func(fd uintptr) { uid, peererr = PeerUID(fd) }); err != nil {
+		t.Fatal(err)
+	}
+	if peererr != nil {
+		t.Fatal(peererr)
+	}
+	if uid != os.Getuid() {
+		t.Errorf("peer uid %d, expected %d", uid, os.Getuid())
+	}
+}
@@ -0,0 +1,20 @@
+// +build darwin freebsd
+
+package util
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// PeerCredSupported tells whether PeerUID is supported on this platform.
+const PeerCredSupported = true
+
+// PeerUID returns the user ID of the process connected to the unix domain
+// socket fd.
+func PeerUID(fd uintptr) (int, error) {
+	cred, err := unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	if err != nil {
+		return -1, err
+	}
+	return int(cred.Uid), nil
+}
@@ -0,0 +1,13 @@
+// +build !windows
+
+package util
+
+import (
+	"syscall"
+)
+
+// Umask sets the file mode creation mask to mask and returns the previous
+// mask.
+func Umask(mask int) int {
+	return syscall.Umask(mask)
+}
@@ -0,0 +1,7 @@
+package util
+
+// Umask does nothing on Windows, which has no file mode creation mask, and
+// returns 0.
+func Umask(mask int) int {
+	return 0
+}
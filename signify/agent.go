@@ -0,0 +1,398 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+const (
+	agentenv     = "GOSIGNIFY_AGENT_SOCK"
+	agentmaxmsg  = 1 << 30 // maximum size of a request
+	agenttimeout = time.Minute
+)
+
+// Agent operations.
+const (
+	agentSign = iota + 1
+	agentLock
+	agentUnlock
+	agentInfo
+)
+
+// Agent response status.
+const (
+	agentOK = iota
+	agentFailure
+)
+
+// agent holds a decrypted secret key and serves sign requests for it.
+type agent struct {
+	mu       sync.Mutex
+	enc      []byte // secret key as stored on disk (encrypted)
+	key      enckey // decrypted secret key, if unlocked
+	unlocked bool
+	comment  string
+}
+
+func newagent(seckeyfile string) (*agent, error) {
+	a := new(agent)
+	util.MlockStruct(&a.key)
+	comment, buf, err := readenckey(seckeyfile)
+	if err != nil {
+		a.wipe()
+		return nil, err
+	}
+	a.enc = buf
+	a.comment = comment
+	if err := decryptseckey(a.enc, &a.key, nil); err != nil {
+		a.wipe()
+		return nil, err
+	}
+	a.unlocked = true
+	return a, nil
+}
+
+// wipe removes all key material from the agent.
+func (a *agent) wipe() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	util.BzeroStruct(&a.key)
+	util.BzeroBytes(a.enc)
+	util.MunlockStruct(&a.key)
+	a.unlocked = false
+}
+
+func (a *agent) sign(msg []byte) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.unlocked {
+		return nil, errors.New("agent is locked")
+	}
+	return ed25519.Sign(a.key.Seckey[:], msg), nil
+}
+
+// info returns the key number followed by the comment of the secret key.
+func (a *agent) info() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keynum, _ := enckeynum(a.enc)
+	return append(keynum[:], a.comment...)
+}
+
+func (a *agent) lock() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.unlocked {
+		return errors.New("agent is already locked")
+	}
+	util.BzeroStruct(&a.key)
+	a.unlocked = false
+	return nil
+}
+
+func (a *agent) unlock(pass []byte) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.unlocked {
+		return errors.New("agent is not locked")
+	}
+	if err := decryptseckey(a.enc, &a.key, pass); err != nil {
+		util.BzeroStruct(&a.key)
+		return err
+	}
+	a.unlocked = true
+	return nil
+}
+
+func writeagentmsg(w io.Writer, code byte, payload []byte) error {
+	var hdr [5]byte
+	hdr[0] = code
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readagentmsg(r io.Reader) (byte, []byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > agentmaxmsg {
+		return 0, nil, errors.New("agent message too large")
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return hdr[0], payload, nil
+}
+
+// checkpeer makes sure that conn is connected to a process of the same user.
+// On platforms without peer credentials we rely on the permissions of the
+// socket directory, which is why custom sockets are refused there.
+func checkpeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.New("not a unix domain socket")
+	}
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var (
+		uid     int
+		peererr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		uid, peererr = util.PeerUID(fd)
+	})
+	if err != nil {
+		return err
+	}
+	if peererr == util.ErrPeerCredUnsupported {
+		return nil
+	}
+	if peererr != nil {
+		return peererr
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("connection from foreign user %d refused", uid)
+	}
+	return nil
+}
+
+func (a *agent) handle(conn net.Conn) {
+	defer conn.Close()
+	if err := checkpeer(conn); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", argv0, err)
+		return
+	}
+	conn.SetDeadline(time.Now().Add(agenttimeout))
+	op, payload, err := readagentmsg(conn)
+	if err != nil {
+		return
+	}
+	var resp []byte
+	switch op {
+	case agentSign:
+		resp, err = a.sign(payload)
+	case agentLock:
+		err = a.lock()
+	case agentInfo:
+		resp = a.info()
+	case agentUnlock:
+		util.MlockBytes(payload)
+		err = a.unlock(payload)
+		util.BzeroBytes(payload)
+		util.MunlockBytes(payload)
+	default:
+		err = fmt.Errorf("unknown agent operation %d", op)
+	}
+	if err != nil {
+		writeagentmsg(conn, agentFailure, []byte(err.Error()))
+		return
+	}
+	writeagentmsg(conn, agentOK, resp)
+}
+
+// serve answers requests on l until l is closed.
+func (a *agent) serve(l net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return nil // listener closed
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.handle(conn)
+		}()
+	}
+}
+
+// agentsocket returns the default socket path of an agent started by the
+// current process, creating the per-user socket directory if necessary.
+func agentsocket() (string, error) {
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("gosignify-%d", os.Getuid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 {
+		return "", fmt.Errorf("unsafe socket directory %s", dir)
+	}
+	uid, err := util.FileUID(fi)
+	if err != nil && err != util.ErrOwnerUnsupported {
+		return "", err
+	}
+	if err == nil && uid != os.Getuid() {
+		return "", fmt.Errorf("socket directory %s is owned by user %d instead of %d, remove it", dir, uid, os.Getuid())
+	}
+	return filepath.Join(dir, fmt.Sprintf("agent.%d", os.Getpid())), nil
+}
+
+// runagent unlocks the secret key in seckeyfile and serves sign requests on
+// the unix domain socket denoted by socket, until the lifetime expires (if
+// not zero) or the agent is interrupted.
+func runagent(seckeyfile, socket string, lifetime time.Duration) error {
+	a, err := newagent(seckeyfile)
+	if err != nil {
+		return err
+	}
+	defer a.wipe()
+
+	if socket == "" {
+		socket, err = agentsocket()
+		if err != nil {
+			return err
+		}
+	} else if !util.PeerCredSupported {
+		return errors.New("custom agent sockets are not supported on this platform")
+	}
+	// create the socket accessible only by the current user right away
+	mask := util.Umask(0177)
+	l, err := net.Listen("unix", socket)
+	util.Umask(mask)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socket)
+
+	var once sync.Once
+	stop := func() { once.Do(func() { l.Close() }) }
+	if lifetime > 0 {
+		t := time.AfterFunc(lifetime, stop)
+		defer t.Stop()
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer close(sigs)
+	defer signal.Stop(sigs)
+	go func() {
+		if _, ok := <-sigs; ok {
+			stop()
+		}
+	}()
+
+	fmt.Printf("%s=%s; export %s;\n", agentenv, socket, agentenv)
+	return a.serve(l)
+}
+
+func agentrequest(socket string, op byte, payload []byte) ([]byte, error) {
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := writeagentmsg(conn, op, payload); err != nil {
+		return nil, err
+	}
+	status, resp, err := readagentmsg(conn)
+	if err != nil {
+		return nil, err
+	}
+	if status != agentOK {
+		return nil, fmt.Errorf("agent: %s", resp)
+	}
+	return resp, nil
+}
+
+// agentsigner signs messages with the key held by an agent.
+type agentsigner struct {
+	socket  string
+	keynum  [keynumlen]byte
+	comment string
+}
+
+// newagentsigner returns a signer for the agent listening on socket. If
+// seckeyfile is given, the agent must hold the key stored in it.
+func newagentsigner(socket, seckeyfile string) (signer, error) {
+	resp, err := agentrequest(socket, agentInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < keynumlen {
+		return nil, errors.New("agent: invalid response")
+	}
+	s := &agentsigner{socket: socket, comment: string(resp[keynumlen:])}
+	copy(s.keynum[:], resp)
+	if seckeyfile != "" {
+		comment, buf, err := readenckey(seckeyfile)
+		if err != nil {
+			return nil, err
+		}
+		keynum, err := enckeynum(buf)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(keynum[:], s.keynum[:]) {
+			return nil, fmt.Errorf("agent does not hold key %s", seckeyfile)
+		}
+		s.comment = comment
+	}
+	return s, nil
+}
+
+func (s *agentsigner) Keynum() [keynumlen]byte {
+	return s.keynum
+}
+
+func (s *agentsigner) Comment() string {
+	return s.comment
+}
+
+func (s *agentsigner) Sign(msg []byte) ([]byte, error) {
+	sig, err := agentrequest(s.socket, agentSign, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != sigbytes {
+		return nil, errors.New("agent: invalid response")
+	}
+	return sig, nil
+}
+
+func (s *agentsigner) Close() error {
+	return nil
+}
+
+func agentlock(socket string) error {
+	_, err := agentrequest(socket, agentLock, nil)
+	return err
+}
+
+func agentunlock(socket string) error {
+	pass, err := readpassphrase("passphrase", false)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(pass)
+	defer util.BzeroBytes(pass)
+	_, err = agentrequest(socket, agentUnlock, pass)
+	return err
+}
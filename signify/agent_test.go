@@ -0,0 +1,159 @@
+package signify
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAgent(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkey := filepath.Join(tmpdir, "key.pub")
+	seckey := filepath.Join(tmpdir, "key.sec")
+	otherpub := filepath.Join(tmpdir, "other.pub")
+	othersec := filepath.Join(tmpdir, "other.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	socket := filepath.Join(tmpdir, "agent.sock")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	passfile, err := createPassfile(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin = passfile
+	if err := Main("signify", "-G", "-p", pubkey, "-s", seckey); err != nil {
+		t.Fatal(err)
+	}
+	passfile.Close()
+	if err := Main("signify", "-G", "-n", "-p", otherpub, "-s", othersec); err != nil {
+		t.Fatal(err)
+	}
+
+	// start agent
+	passfile, err = createPassfile(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin = passfile
+	a, err := newagent(seckey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passfile.Close()
+	defer a.wipe()
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- a.serve(l) }()
+	defer func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+	os.Setenv(agentenv, socket)
+	defer os.Unsetenv(agentenv)
+
+	// sign without seckey
+	if err := Main("signify", "-S", "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// sign with matching seckey
+	if err := Main("signify", "-S", "-s", seckey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-m", msgfile, "-p", pubkey); err != nil {
+		t.Fatal(err)
+	}
+	// agent holds a different key
+	if err := Main("signify", "-S", "-s", othersec, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// lock agent
+	if err := Main("signify", "-agent", "-lock"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-agent", "-lock", "-socket", socket); err == nil {
+		t.Error("should fail")
+	}
+	// unlock agent with wrong passphrase
+	wrongpass := filepath.Join(tmpdir, "wrongpass.txt")
+	if err := ioutil.WriteFile(wrongpass, []byte("wrong\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	passfile, err = os.Open(wrongpass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin = passfile
+	if err := Main("signify", "-agent", "-unlock"); err == nil {
+		t.Error("should fail")
+	}
+	passfile.Close()
+	// unlock agent
+	passfile, err = createPassfile(tmpdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin = passfile
+	if err := Main("signify", "-agent", "-unlock"); err != nil {
+		t.Fatal(err)
+	}
+	passfile.Close()
+	if err := Main("signify", "-S", "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// -lock and -unlock are mutually exclusive
+	if err := Main("signify", "-agent", "-lock", "-unlock"); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestAgentSocket(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	tmp := os.Getenv("TMPDIR")
+	defer os.Setenv("TMPDIR", tmp)
+	os.Setenv("TMPDIR", tmpdir)
+	socket, err := agentsocket()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(filepath.Dir(socket)) != tmpdir {
+		t.Fatalf("socket %s not in %s", socket, tmpdir)
+	}
+	// socket directory of another user
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner requires root")
+	}
+	if err := os.Chown(filepath.Dir(socket), 1, -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := agentsocket(); err == nil {
+		t.Error("should fail")
+	}
+}
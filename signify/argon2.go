@@ -0,0 +1,249 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/util"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	argonalg      = "A2" // Argon2id and XChaCha20-Poly1305 (version 2 secret keys)
+	argontime     = 3
+	argonmemory   = 64 // MiB
+	argonthreads  = 4
+	argonmaxtime  = 100  // maximum number of passes accepted
+	argonmaxmem   = 4096 // maximum memory accepted in MiB
+	argontagbytes = 16   // Poly1305 authenticator
+)
+
+// argonparams are the tunable parameters of Argon2id.
+type argonparams struct {
+	time   uint32 // number of passes
+	memory uint32 // MiB
+}
+
+// enckeyv2 is a version 2 secret key. The secret key is encrypted with
+// XChaCha20-Poly1305 under a key derived with Argon2id and all other fields
+// are authenticated as associated data. A Kdftime of zero denotes a key
+// without passphrase.
+type enckeyv2 struct {
+	Pkalg      [2]byte
+	Kdfalg     [2]byte
+	Kdftime    [4]byte
+	Kdfmemory  [4]byte // KiB
+	Kdfthreads [4]byte
+	Salt       [16]byte
+	Nonce      [chacha20poly1305.NonceSizeX]byte
+	Keynum     [keynumlen]byte
+	Seckey     [secretbytes + argontagbytes]byte
+}
+
+// header returns the fields of k which are authenticated but not encrypted.
+func (k *enckeyv2) header() []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, k)
+	return buf.Bytes()[:buf.Len()-len(k.Seckey)]
+}
+
+// argonkey derives the encryption key of k from pass and the hash of the
+// keyfile, if any.
+func (k *enckeyv2) argonkey(pass, keyfile []byte, key []byte) {
+	time := binary.BigEndian.Uint32(k.Kdftime[:])
+	memory := binary.BigEndian.Uint32(k.Kdfmemory[:])
+	threads := binary.BigEndian.Uint32(k.Kdfthreads[:])
+	secret := append(append(make([]byte, 0, len(pass)+len(keyfile)), pass...), keyfile...)
+	util.MlockBytes(secret)
+	defer util.MunlockBytes(secret)
+	defer util.BzeroBytes(secret)
+	dk := argon2.IDKey(secret, k.Salt[:], time, memory, uint8(threads), uint32(len(key)))
+	util.MlockBytes(dk)
+	defer util.MunlockBytes(dk)
+	defer util.BzeroBytes(dk)
+	copy(key, dk)
+}
+
+// encryptv2 encrypts the decrypted secret key in enckey as version 2 secret
+// key with passphrase pass. If pass is nil, the key is not protected by a
+// passphrase. If keyfile, the hash of a keyfile, is not nil, the key can only
+// be decrypted with both the passphrase and the keyfile.
+func encryptv2(enckey *enckey, params *argonparams, pass, keyfile []byte) ([]byte, error) {
+	var key [chacha20poly1305.KeySize]byte
+	util.MlockBytes(key[:])
+	defer util.MunlockBytes(key[:])
+	defer util.BzeroBytes(key[:])
+
+	if params.time == 0 || params.memory == 0 ||
+		params.time > argonmaxtime || params.memory > argonmaxmem {
+		return nil, errors.New("invalid KDF parameters")
+	}
+	if keyfile != nil && pass == nil {
+		return nil, errors.New("keyfile requires a passphrase")
+	}
+	k := new(enckeyv2)
+	copy(k.Pkalg[:], []byte(pkalg))
+	copy(k.Kdfalg[:], []byte(argonalg))
+	if keyfile != nil {
+		copy(k.Kdfalg[:], []byte(keyfilealg))
+	}
+	if pass != nil {
+		binary.BigEndian.PutUint32(k.Kdftime[:], params.time)
+		binary.BigEndian.PutUint32(k.Kdfmemory[:], params.memory*1024)
+		binary.BigEndian.PutUint32(k.Kdfthreads[:], argonthreads)
+	}
+	if _, err := io.ReadFull(rand.Reader, k.Salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, k.Nonce[:]); err != nil {
+		return nil, err
+	}
+	k.Keynum = enckey.Keynum
+	var check []byte
+	if keyfile != nil {
+		check = keyfilecheck(k.Salt[:], keyfile)
+	}
+	if pass != nil {
+		k.argonkey(pass, keyfile, key[:])
+	}
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead.Seal(k.Seckey[:0], k.Nonce[:], enckey.Seckey[:], append(k.header(), check...))
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, k)
+	buf.Write(check)
+	return buf.Bytes(), nil
+}
+
+// decryptv2 decrypts the version 2 secret key in buf into enckey with
+// passphrase pass, which is read from stdin if nil. Keys which also require
+// a keyfile are decrypted with the keyfile named by $GOSIGNIFY_KEYFILE.
+func decryptv2(buf []byte, enckey *enckey, pass []byte) error {
+	var (
+		k       enckeyv2
+		key     [chacha20poly1305.KeySize]byte
+		check   []byte
+		keyfile []byte
+	)
+	util.MlockBytes(key[:])
+	defer util.MunlockBytes(key[:])
+	defer util.BzeroBytes(key[:])
+
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &k); err != nil {
+		return err
+	}
+	if string(k.Kdfalg[:]) == keyfilealg {
+		check = buf[binary.Size(&k):]
+		if len(check) != keyfilecheckbytes || binary.BigEndian.Uint32(k.Kdftime[:]) == 0 {
+			return errors.New("invalid secret key")
+		}
+		digest, err := unlockkeyfile(k.Salt[:], check)
+		if err != nil {
+			return err
+		}
+		defer util.MunlockBytes(digest)
+		defer util.BzeroBytes(digest)
+		keyfile = digest
+	} else if len(buf) != binary.Size(&k) {
+		return errors.New("invalid secret key")
+	}
+	if time := binary.BigEndian.Uint32(k.Kdftime[:]); time > 0 {
+		// refuse parameters which would exhaust memory or run forever
+		memory := binary.BigEndian.Uint32(k.Kdfmemory[:])
+		threads := binary.BigEndian.Uint32(k.Kdfthreads[:])
+		if threads == 0 || threads > 255 || time > argonmaxtime || memory > argonmaxmem*1024 {
+			return errors.New("invalid KDF parameters")
+		}
+		if pass == nil {
+			p, err := readpassphrase("passphrase", false)
+			if err != nil {
+				return err
+			}
+			defer util.MunlockBytes(p)
+			defer util.BzeroBytes(p)
+			pass = p
+		}
+		k.argonkey(pass, keyfile, key[:])
+	}
+	aead, err := chacha20poly1305.NewX(key[:])
+	if err != nil {
+		return err
+	}
+	copy(enckey.Pkalg[:], k.Pkalg[:])
+	copy(enckey.Kdfalg[:], k.Kdfalg[:])
+	enckey.Keynum = k.Keynum
+	if _, err := aead.Open(enckey.Seckey[:0], k.Nonce[:], k.Seckey[:], append(k.header(), check...)); err != nil {
+		return errors.New("incorrect passphrase")
+	}
+	return nil
+}
+
+// migrate re-encrypts the secret key in seckeyfile as version 2 secret key,
+// or to the recipients of opts. The key file is replaced atomically.
+func migrate(seckeyfile string, opts *protectopts, protect bool) error {
+	var (
+		enckey enckey
+		pass   []byte
+	)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	if !regularfile(seckeyfile) {
+		return fmt.Errorf("%s is not a regular file", seckeyfile)
+	}
+	comment, buf, err := readenckey(seckeyfile)
+	if err != nil {
+		return err
+	}
+	if err := decryptseckey(buf, &enckey, nil); err != nil {
+		return err
+	}
+	var k []byte
+	if len(opts.recipients) > 0 {
+		k, err = encryptrecipients(&enckey, opts.recipients)
+	} else {
+		if protect {
+			pass, err = readpassphrase("new passphrase", true)
+			if err != nil {
+				return err
+			}
+			defer util.MunlockBytes(pass)
+			defer util.BzeroBytes(pass)
+		}
+		var keyfile []byte
+		if opts.keyfile != "" {
+			if !protect {
+				return errors.New("keyfile requires a passphrase")
+			}
+			keyfile, err = readkeyfile(opts.keyfile, true)
+			if err != nil {
+				return err
+			}
+			defer util.MunlockBytes(keyfile)
+			defer util.BzeroBytes(keyfile)
+		}
+		k, err = encryptv2(&enckey, opts.argon, pass, keyfile)
+	}
+	if err != nil {
+		return err
+	}
+	util.BzeroStruct(&enckey) // wipe early, wipe often
+	tmpfile := seckeyfile + ".tmp"
+	if err := writeb64file(tmpfile, comment, k, nil, os.O_EXCL, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpfile, seckeyfile); err != nil {
+		os.Remove(tmpfile)
+		return err
+	}
+	return nil
+}
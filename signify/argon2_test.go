@@ -0,0 +1,165 @@
+package signify
+
+import (
+	"encoding/binary"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setstdin replaces stdin with a file containing input.
+func setstdin(t *testing.T, tmpdir, input string) {
+	passname := filepath.Join(tmpdir, "stdin.txt")
+	if err := ioutil.WriteFile(passname, []byte(input), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fp, err := os.Open(passname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdin = fp
+}
+
+func TestArgon2id(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\ntopsecret\n")
+	if err := Main("signify", "-G", "-argon2id", "-kdfmemory", "1", "-kdftime", "1",
+		"-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	_, buf, err := readb64file(seckeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[2:4]) != argonalg {
+		t.Fatalf("unexpected KDF %s", buf[2:4])
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "wrong\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// the header is authenticated
+	comment, buf, err := readb64file(seckeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[len(buf)-secretbytes-argontagbytes-1] ^= 1 // key number
+	tampered := filepath.Join(tmpdir, "tampered.sec")
+	if err := writeb64file(tampered, comment, buf, nil, os.O_EXCL, 0600); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-S", "-s", tampered, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// excessive KDF parameters and trailing bytes are rejected
+	_, buf, err = readb64file(seckeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var enckey enckey
+	if err := decryptv2(buf, &enckey, []byte("topsecret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := decryptv2(append(buf, 0), &enckey, []byte("topsecret")); err == nil {
+		t.Error("should fail")
+	}
+	for _, off := range []int{4, 8} { // Kdftime, Kdfmemory
+		huge := append([]byte{}, buf...)
+		binary.BigEndian.PutUint32(huge[off:], 0xffffffff)
+		if err := decryptv2(huge, &enckey, []byte("topsecret")); err == nil {
+			t.Error("should fail")
+		}
+	}
+	for _, args := range [][]string{{"-kdfmemory", "4097"}, {"-kdftime", "101"}} {
+		args = append([]string{"signify", "-G", "-n", "-argon2id"}, args...)
+		err := Main(append(args, "-p", filepath.Join(tmpdir, "x.pub"), "-s", filepath.Join(tmpdir, "x.sec"))...)
+		if err != flag.ErrHelp {
+			t.Errorf("%v: unexpected error: %v", args, err)
+		}
+	}
+
+	// keys without passphrase
+	if err := Main("signify", "-G", "-n", "-argon2id", "-kdfmemory", "1", "-kdftime", "1",
+		"-p", filepath.Join(tmpdir, "n.pub"), "-s", filepath.Join(tmpdir, "n.sec")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", filepath.Join(tmpdir, "n.sec"), "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", filepath.Join(tmpdir, "n.pub"), "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-argon2id", "-kdfmemory", "0",
+		"-p", filepath.Join(tmpdir, "x.pub"), "-s", filepath.Join(tmpdir, "x.sec")); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\ntopsecret\n")
+	if err := Main("signify", "-G", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "wrong\nnewsecret\nnewsecret\n")
+	if err := Main("signify", "-migrate", "-kdfmemory", "1", "-kdftime", "1", "-s", seckeyfile); err == nil {
+		t.Error("should fail")
+	}
+	setstdin(t, tmpdir, "topsecret\nnewsecret\nnewsecret\n")
+	if err := Main("signify", "-migrate", "-kdfmemory", "1", "-kdftime", "1", "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	comment, buf, err := readb64file(seckeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[2:4]) != argonalg {
+		t.Errorf("unexpected KDF %s", buf[2:4])
+	}
+	if comment != "signify secret key" {
+		t.Errorf("unexpected comment %q", comment)
+	}
+	setstdin(t, tmpdir, "newsecret\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,249 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	certalg     = "CE" // certificate of a subkey
+	certsigalg  = "CS" // signature of a subkey followed by its certificate
+	certcontext = "gosignify subkey certificate v1\x00"
+)
+
+// cert is a certificate in which a master key allows a subkey to sign
+// between Notbefore and Notafter (seconds since the epoch). It is followed by
+// the namespace and the file name pattern the subkey is restricted to, each
+// preceded by its length as uint16. Empty constraints do not restrict the
+// subkey. Signatures of a subkey restricted to a namespace are made in it.
+type cert struct {
+	Pkalg     [2]byte
+	Keynum    [keynumlen]byte // of the master key
+	Sig       [sigbytes]byte
+	Subpkalg  [2]byte
+	Subkeynum [keynumlen]byte
+	Subpubkey [publicbytes]byte
+	Notbefore int64
+	Notafter  int64
+}
+
+// certificate is a parsed cert together with its constraints.
+type certificate struct {
+	cert
+	namespace string
+	pattern   string
+}
+
+// certmsg returns the signed part of c.
+func certmsg(c *certificate) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(certcontext)
+	buf.Write(c.Subpkalg[:])
+	buf.Write(c.Subkeynum[:])
+	buf.Write(c.Subpubkey[:])
+	binary.Write(&buf, binary.BigEndian, c.Notbefore)
+	binary.Write(&buf, binary.BigEndian, c.Notafter)
+	writestring(&buf, c.namespace)
+	writestring(&buf, c.pattern)
+	return buf.Bytes()
+}
+
+func writestring(w io.Writer, s string) {
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	io.WriteString(w, s)
+}
+
+func readstring(r io.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func marshalcert(c *certificate) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, &c.cert)
+	writestring(&buf, c.namespace)
+	writestring(&buf, c.pattern)
+	return buf.Bytes()
+}
+
+func parsecert(buf []byte) (*certificate, error) {
+	c := new(certificate)
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, &c.cert); err != nil {
+		return nil, errors.New("invalid certificate")
+	}
+	if string(c.Pkalg[:]) != certalg || string(c.Subpkalg[:]) != pkalg {
+		return nil, errors.New("unsupported certificate")
+	}
+	var err error
+	if c.namespace, err = readstring(r); err != nil {
+		return nil, errors.New("invalid certificate")
+	}
+	if c.pattern, err = readstring(r); err != nil || r.Len() != 0 {
+		return nil, errors.New("invalid certificate")
+	}
+	return c, nil
+}
+
+func readcert(certfile string) (*certificate, error) {
+	_, buf, err := readb64file(certfile)
+	if err != nil {
+		return nil, err
+	}
+	return parsecert(buf)
+}
+
+// certify signs a certificate for the subkey in subpubkeyfile with the master
+// key seckey and writes it to certfile.
+func certify(seckey, subpubkeyfile, certfile string, notbefore, notafter time.Time, namespace, pattern string) error {
+	var pubkey pubkey
+	if err := readpubkeyfile(subpubkeyfile, &pubkey); err != nil {
+		return err
+	}
+	if !notafter.After(notbefore) {
+		return errors.New("certificate expires before it becomes valid")
+	}
+	if len(namespace) > 0xffff || len(pattern) > 0xffff {
+		return errors.New("constraint too long")
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid file name pattern %s", pattern)
+	}
+	c := &certificate{namespace: namespace, pattern: pattern}
+	c.Subpkalg = pubkey.Pkalg
+	c.Subkeynum = pubkey.Keynum
+	c.Subpubkey = pubkey.Pubkey
+	c.Notbefore = notbefore.Unix()
+	c.Notafter = notafter.Unix()
+
+	signer, err := newsigner(seckey)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	s, err := signer.Sign(certmsg(c))
+	if err != nil {
+		return err
+	}
+	copy(c.Pkalg[:], []byte(certalg))
+	c.Keynum = signer.Keynum()
+	copy(c.Sig[:], s)
+
+	comment := fmt.Sprintf("certificate for %s", filepath.Base(subpubkeyfile))
+	return writeb64file(certfile, comment, marshalcert(c), nil, os.O_TRUNC, 0666)
+}
+
+// checkcert checks that c is valid at time now and that its constraints allow
+// signing the file name with the given namespace.
+func checkcert(c *certificate, now time.Time, namespace, name string) error {
+	if now.Unix() < c.Notbefore {
+		return fmt.Errorf("certificate not valid before %s",
+			time.Unix(c.Notbefore, 0).UTC().Format(time.RFC3339))
+	}
+	if now.Unix() > c.Notafter {
+		return fmt.Errorf("certificate expired at %s",
+			time.Unix(c.Notafter, 0).UTC().Format(time.RFC3339))
+	}
+	if c.namespace != "" && c.namespace != namespace {
+		return fmt.Errorf("certificate restricted to namespace %s", c.namespace)
+	}
+	if c.pattern != "" {
+		if ok, _ := filepath.Match(c.pattern, filepath.Base(name)); !ok {
+			return fmt.Errorf("certificate restricted to files matching %s", c.pattern)
+		}
+	}
+	return nil
+}
+
+// appendcert turns the signature s into a signature which carries the
+// certificate in certfile.
+func appendcert(s *sig, certfile string) ([]byte, error) {
+	c, err := readcert(certfile)
+	if err != nil {
+		return nil, err
+	}
+	if c.Subkeynum != s.Keynum {
+		return nil, errors.New("certificate is for another key")
+	}
+	if time.Now().Unix() > c.Notafter {
+		return nil, errors.New("certificate expired")
+	}
+	buf := bytes.NewBufferString(certsigalg)
+	if err := binary.Write(buf, binary.BigEndian, s); err != nil {
+		return nil, err
+	}
+	buf.Write(marshalcert(c))
+	return buf.Bytes(), nil
+}
+
+// splitcertsig splits a signature made with a subkey into the signature and
+// the certificate.
+func splitcertsig(buf []byte) (*sig, *certificate, error) {
+	s := new(sig)
+	r := bytes.NewReader(buf[len(certsigalg):])
+	if err := binary.Read(r, binary.BigEndian, s); err != nil {
+		return nil, nil, errors.New("invalid signature")
+	}
+	if string(s.Pkalg[:]) != pkalg {
+		return nil, nil, errors.New("unsupported signature algorithm")
+	}
+	c, err := parsecert(buf[len(buf)-r.Len():])
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, c, nil
+}
+
+// verifycertsig verifies msg, named name, against the signature in buf made
+// with a subkey certified by master.
+func verifycertsig(opts *verifyopts, master *pubkey, name string, buf []byte, msg *message) error {
+	s, c, err := splitcertsig(buf)
+	if err != nil {
+		return err
+	}
+	if len(opts.chain) > 0 {
+		if master, err = chainkey(master, opts.chain, c.Keynum, opts.revocations); err != nil {
+			return err
+		}
+	}
+	if c.Keynum != master.Keynum {
+		return errors.New("verification failed: certificate checked against wrong key")
+	}
+	if !ed25519.Verify(master.Pubkey[:], certmsg(c), c.Sig[:]) {
+		return errors.New("certificate verification failed")
+	}
+	if err := opts.checkrevoked(c.Keynum); err != nil {
+		return err
+	}
+	if err := opts.checkrevoked(c.Subkeynum); err != nil {
+		return err
+	}
+	if err := checkcert(c, time.Now(), opts.namespace, name); err != nil {
+		return err
+	}
+	if c.namespace == "" && opts.namespace != "" {
+		return fmt.Errorf("signature not made in namespace %s", opts.namespace)
+	}
+	subkey := pubkey{Pkalg: c.Subpkalg, Keynum: c.Subkeynum, Pubkey: c.Subpubkey}
+	return verifymsg(&subkey, msg.withhead(namespacehead(c.namespace)), s, opts.quiet)
+}
+
+// msgname returns the name of the message embedded in sigfile.
+func msgname(sigfile string) string {
+	return strings.TrimSuffix(sigfile, ".sig")
+}
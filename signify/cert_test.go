@@ -0,0 +1,113 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCertify(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	masterpub := filepath.Join(tmpdir, "master.pub")
+	mastersec := filepath.Join(tmpdir, "master.sec")
+	subpub := filepath.Join(tmpdir, "nightly.pub")
+	subsec := filepath.Join(tmpdir, "nightly.sec")
+	certfile := filepath.Join(tmpdir, "nightly.cert")
+	msgfile := filepath.Join(tmpdir, "release.tgz")
+	otherfile := filepath.Join(tmpdir, "other.txt")
+	for _, k := range [][2]string{{masterpub, mastersec}, {subpub, subsec}} {
+		if err := Main("signify", "-G", "-n", "-p", k[0], "-s", k[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{msgfile, otherfile} {
+		if err := createMsgfile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tomorrow := time.Now().Add(24 * time.Hour).Format(time.RFC3339)
+	if err := Main("signify", "-certify", "-expire", tomorrow, "-namespace", "nightly",
+		"-pattern", "*.tgz", "-s", mastersec, "-p", subpub, "-x", certfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-cert", certfile, "-s", subsec, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "nightly", "-p", masterpub, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// embedded
+	sigfile := filepath.Join(tmpdir, "embedded.tgz.sig")
+	if err := Main("signify", "-S", "-e", "-cert", certfile, "-s", subsec, "-m", msgfile,
+		"-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-e", "-q", "-namespace", "nightly", "-p", masterpub,
+		"-m", filepath.Join(tmpdir, "extracted"), "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	// wrong namespace
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-p", masterpub, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-p", masterpub, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// the subkey is not trusted by itself
+	if err := Main("signify", "-V", "-q", "-namespace", "nightly", "-p", subpub, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// file name does not match pattern
+	if err := Main("signify", "-S", "-cert", certfile, "-s", subsec, "-m", otherfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "nightly", "-p", masterpub, "-m", otherfile); err == nil {
+		t.Error("should fail")
+	}
+	// tampered certificate
+	tampered := filepath.Join(tmpdir, "tampered.sig")
+	comment, buf, err := readb64file(otherfile + ".sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sg, c, err := splitcertsig(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.pattern = "*"
+	buf, err = appendcert(sg, certfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = append(buf[:len(buf)-len(marshalcert(c))], marshalcert(c)...)
+	if err := writeb64file(tampered, comment, buf, nil, os.O_EXCL, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "nightly", "-p", masterpub,
+		"-m", otherfile, "-x", tampered); err == nil {
+		t.Error("should fail")
+	}
+	// certificate of another key
+	if err := Main("signify", "-S", "-cert", certfile, "-s", mastersec, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// expired certificate
+	if err := Main("signify", "-certify", "-start", "2000-01-01", "-expire", "2000-01-02",
+		"-s", mastersec, "-p", subpub, "-x", certfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-cert", certfile, "-s", subsec, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// signatures are rejected after the certificate expired
+	c.pattern = ""
+	if err := checkcert(c, time.Now().Add(48*time.Hour), "nightly", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
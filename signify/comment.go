@@ -0,0 +1,66 @@
+package signify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+// setcomment replaces the untrusted comment of the key or signature file
+// filename with comment. The rest of the file is kept byte for byte and
+// secret keys are not decrypted. The file is replaced atomically.
+func setcomment(filename, comment string) error {
+	if strings.ContainsAny(comment, "\r\n") {
+		return errors.New("comment must be a single line")
+	}
+	header := fmt.Sprintf("%s%s\n", commenthdr, comment)
+	if len(header) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filename)
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	util.MlockBytes(data)
+	defer util.MunlockBytes(data)
+	defer util.BzeroBytes(data)
+	if _, _, _, err := parseb64file(filename, data); err != nil {
+		return err
+	}
+	rest := data[bytes.IndexByte(data, '\n')+1:]
+
+	tmpfile := filename + ".tmp"
+	fd, err := xopen(tmpfile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, int(fi.Mode().Perm()))
+	if err != nil {
+		return err
+	}
+	if _, err = fd.WriteString(header); err == nil {
+		_, err = fd.Write(rest)
+	}
+	if err == nil {
+		err = fd.Sync()
+	}
+	if e := fd.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmpfile, filename)
+	}
+	if err != nil {
+		os.Remove(tmpfile)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package signify
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComment(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	sigfile := filepath.Join(tmpdir, "message.txt.sig")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\ntopsecret\n")
+	if err := Main("signify", "-G", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-S", "-e", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	files := []string{pubkeyfile, seckeyfile, sigfile}
+	var before [][]byte
+	for _, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before = append(before, data)
+	}
+
+	// no passphrase is read
+	setstdin(t, tmpdir, "")
+	if err := Main("signify", "-comment", "-c", "release 2026", pubkeyfile, seckeyfile, sigfile); err != nil {
+		t.Fatal(err)
+	}
+	for i, filename := range files {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.SplitAfterN(string(data), "\n", 2)
+		if lines[0] != commenthdr+"release 2026\n" {
+			t.Errorf("%s: comment is %q", filename, lines[0])
+		}
+		if !bytes.HasSuffix(before[i], []byte(lines[1])) ||
+			len(before[i])-len(lines[1]) != bytes.IndexByte(before[i], '\n')+1 {
+			t.Errorf("%s: rest of the file changed", filename)
+		}
+	}
+	fi, err := os.Stat(seckeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("secret key has mode %04o", fi.Mode().Perm())
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-S", "-x", filepath.Join(tmpdir, "new.sig"), "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-e", "-x", sigfile, "-p", pubkeyfile, "-m", filepath.Join(tmpdir, "extracted.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	// invalid comments and files
+	if err := Main("signify", "-comment", pubkeyfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-comment", "-c", strings.Repeat("x", commentmaxlen), pubkeyfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-comment", "-c", "two\nlines", pubkeyfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-comment", "-c", "message", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := os.Stat(pubkeyfile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file should not exist")
+	}
+}
@@ -0,0 +1,228 @@
+package signify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/cbor"
+)
+
+// COSE constants from RFC 9052 and RFC 9053.
+const (
+	coseSign1Tag     = 18
+	coseHeaderAlg    = 1
+	coseHeaderKid    = 4
+	coseAlgEdDSA     = -8
+	coseSign1Context = "Signature1"
+)
+
+// cosesigstructure returns the Sig_structure for a COSE_Sign1 message, which
+// is what is actually signed (RFC 9052, Section 4.4).
+func cosesigstructure(protected, aad, payload []byte) []byte {
+	var enc cbor.Encoder
+	enc.Array(4)
+	enc.TextString(coseSign1Context)
+	enc.ByteString(protected)
+	enc.ByteString(aad)
+	enc.ByteString(payload)
+	return enc.Bytes()
+}
+
+// coseprotected returns the serialized protected header for a signature made
+// with the key denoted by keynum.
+func coseprotected(keynum []byte) []byte {
+	var enc cbor.Encoder
+	enc.Map(2)
+	enc.Int(coseHeaderAlg)
+	enc.Int(coseAlgEdDSA)
+	enc.Int(coseHeaderKid)
+	enc.ByteString(keynum)
+	return enc.Bytes()
+}
+
+func readaad(aadfile string) ([]byte, error) {
+	if aadfile == "" {
+		return []byte{}, nil
+	}
+	return readmsg(aadfile)
+}
+
+func signcose(seckeyfile, msgfile, sigfile, aadfile string, embedded bool) error {
+	signer, err := newsigner(seckeyfile)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+
+	msg, err := readmsg(msgfile)
+	if err != nil {
+		return err
+	}
+	aad, err := readaad(aadfile)
+	if err != nil {
+		return err
+	}
+
+	keynum := signer.Keynum()
+	protected := coseprotected(keynum[:])
+	sig, err := signer.Sign(cosesigstructure(protected, aad, msg))
+	if err != nil {
+		return err
+	}
+	signer.Close() // wipe early, wipe often
+
+	var enc cbor.Encoder
+	enc.Tag(coseSign1Tag)
+	enc.Array(4)
+	enc.ByteString(protected)
+	enc.Map(0)
+	if embedded {
+		enc.ByteString(msg)
+	} else {
+		enc.Null()
+	}
+	enc.ByteString(sig)
+
+	fd, err := xopen(sigfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if _, err := fd.Write(enc.Bytes()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// cosesign1 is a decoded COSE_Sign1 message.
+type cosesign1 struct {
+	protected []byte
+	kid       []byte
+	payload   []byte // nil, if the payload is detached
+	signature []byte
+}
+
+func coseheader(protected, unprotected cbor.Map, label int64) (interface{}, bool) {
+	if v, ok := protected[label]; ok {
+		return v, true
+	}
+	v, ok := unprotected[label]
+	return v, ok
+}
+
+func parsecose(data []byte) (*cosesign1, error) {
+	v, err := cbor.Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+	if tag, ok := v.(cbor.Tag); ok {
+		if tag.Number != coseSign1Tag {
+			return nil, errors.New("not a COSE_Sign1 message")
+		}
+		v = tag.Content
+	}
+	a, ok := v.([]interface{})
+	if !ok || len(a) != 4 {
+		return nil, errors.New("invalid COSE_Sign1 structure")
+	}
+	var c cosesign1
+	if c.protected, ok = a[0].([]byte); !ok {
+		return nil, errors.New("invalid COSE_Sign1 protected header")
+	}
+	protected := cbor.Map{}
+	if len(c.protected) > 0 {
+		p, err := cbor.Unmarshal(c.protected)
+		if err != nil {
+			return nil, err
+		}
+		if protected, ok = p.(cbor.Map); !ok {
+			return nil, errors.New("invalid COSE_Sign1 protected header")
+		}
+	}
+	unprotected, ok := a[1].(cbor.Map)
+	if !ok {
+		return nil, errors.New("invalid COSE_Sign1 unprotected header")
+	}
+	if a[2] != nil {
+		if c.payload, ok = a[2].([]byte); !ok {
+			return nil, errors.New("invalid COSE_Sign1 payload")
+		}
+	}
+	if c.signature, ok = a[3].([]byte); !ok || len(c.signature) != sigbytes {
+		return nil, errors.New("invalid COSE_Sign1 signature")
+	}
+	if alg, ok := protected[int64(coseHeaderAlg)]; !ok || alg != int64(coseAlgEdDSA) {
+		return nil, errors.New("unsupported COSE algorithm")
+	}
+	kid, ok := coseheader(protected, unprotected, coseHeaderKid)
+	if !ok {
+		return nil, errors.New("COSE_Sign1 message without key ID")
+	}
+	if c.kid, ok = kid.([]byte); !ok || len(c.kid) != keynumlen {
+		return nil, errors.New("invalid COSE_Sign1 key ID")
+	}
+	return &c, nil
+}
+
+func verifycose(pubkeyfile, msgfile, sigfile, aadfile string, embedded, quiet bool) error {
+	var (
+		sig    sig
+		pubkey pubkey
+	)
+
+	data, err := readmsg(sigfile)
+	if err != nil {
+		return err
+	}
+	c, err := parsecose(data)
+	if err != nil {
+		return err
+	}
+	aad, err := readaad(aadfile)
+	if err != nil {
+		return err
+	}
+	buf, err := readpubkey(pubkeyfile, "", pkalg)
+	if err != nil {
+		return err
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &pubkey); err != nil {
+		return err
+	}
+
+	msg := c.payload
+	if embedded {
+		if msg == nil {
+			return errors.New("COSE_Sign1 payload is detached")
+		}
+	} else {
+		if msg != nil {
+			return errors.New("COSE_Sign1 payload is attached")
+		}
+		msg, err = readmsg(msgfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	copy(sig.Pkalg[:], []byte(pkalg))
+	copy(sig.Keynum[:], c.kid)
+	copy(sig.Sig[:], c.signature)
+	if err := verifymsg(&pubkey, &message{buf: cosesigstructure(c.protected, aad, msg)}, &sig, quiet); err != nil {
+		return err
+	}
+
+	if embedded {
+		fd, err := xopen(msgfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		if _, err := fd.Write(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCOSE(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkey := filepath.Join(tmpdir, "key.pub")
+	seckey := filepath.Join(tmpdir, "key.sec")
+	otherpub := filepath.Join(tmpdir, "other.pub")
+	othersec := filepath.Join(tmpdir, "other.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	aadfile := filepath.Join(tmpdir, "aad.txt")
+	extracted := filepath.Join(tmpdir, "extracted.txt")
+	coseFile := filepath.Join(tmpdir, "embedded.cose")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(aadfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", pubkey, "-s", seckey); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", otherpub, "-s", othersec); err != nil {
+		t.Fatal(err)
+	}
+
+	// detached payload
+	if err := Main("signify", "-S", "-cose", "-s", seckey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-cose", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// wrong key
+	if err := Main("signify", "-V", "-cose", "-q", "-p", otherpub, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// payload is detached
+	if err := Main("signify", "-V", "-cose", "-q", "-e", "-p", pubkey, "-m", extracted,
+		"-x", msgfile+".cose"); err == nil {
+		t.Error("should fail")
+	}
+
+	// detached payload with external AAD
+	if err := Main("signify", "-S", "-cose", "-aad", aadfile, "-s", seckey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-cose", "-q", "-aad", aadfile, "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// missing AAD
+	if err := Main("signify", "-V", "-cose", "-q", "-p", pubkey, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// attached payload
+	if err := Main("signify", "-S", "-cose", "-e", "-s", seckey, "-m", msgfile, "-x", coseFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-cose", "-q", "-e", "-p", pubkey, "-m", extracted, "-x", coseFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(msgfile, extracted); err != nil {
+		t.Error(err)
+	}
+	// payload is attached
+	if err := Main("signify", "-V", "-cose", "-q", "-p", pubkey, "-m", msgfile, "-x", coseFile); err == nil {
+		t.Error("should fail")
+	}
+
+	// corrupted message
+	cose, err := ioutil.ReadFile(coseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cose[len(cose)-sigbytes-10] ^= 1
+	if err := ioutil.WriteFile(coseFile, cose, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-cose", "-q", "-e", "-p", pubkey, "-m", extracted, "-x", coseFile); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,156 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+const (
+	derivelabel   = "ed25519 seed" // SLIP-0010
+	hardened      = 1 << 31
+	keynumcontext = "gosignify derived keynum v1"
+)
+
+// parsepath parses a derivation path like m/1/2026. All indices are hardened,
+// a trailing ' or h is optional. The canonical form of the path is returned
+// as well.
+func parsepath(path string) ([]uint32, string, error) {
+	elems := strings.Split(path, "/")
+	if elems[0] != "m" {
+		return nil, "", fmt.Errorf("invalid derivation path %s: must start with m", path)
+	}
+	var indices []uint32
+	canonical := "m"
+	for _, e := range elems[1:] {
+		if strings.HasSuffix(e, "'") || strings.HasSuffix(e, "h") {
+			e = e[:len(e)-1]
+		}
+		i, err := strconv.ParseUint(e, 10, 31)
+		if err != nil || e != strconv.FormatUint(i, 10) {
+			return nil, "", fmt.Errorf("invalid derivation path %s", path)
+		}
+		indices = append(indices, uint32(i))
+		canonical += fmt.Sprintf("/%d'", i)
+	}
+	if len(indices) == 0 {
+		return nil, "", errors.New("derivation path must not be m")
+	}
+	return indices, canonical, nil
+}
+
+// derivekey derives the Ed25519 seed for path from seed as in SLIP-0010 and
+// returns it with its chain code.
+func derivekey(seed []byte, path []uint32) ([]byte, []byte) {
+	mac := hmac.New(sha512.New, []byte(derivelabel))
+	mac.Write(seed)
+	i := mac.Sum(nil)
+	defer util.BzeroBytes(i)
+	key := append([]byte{}, i[:32]...)
+	chain := append([]byte{}, i[32:]...)
+	for _, index := range path {
+		var data [1 + 32 + 4]byte
+		copy(data[1:], key)
+		binary.BigEndian.PutUint32(data[33:], index|hardened)
+		mac = hmac.New(sha512.New, chain)
+		mac.Write(data[:])
+		util.BzeroBytes(data[:]) // wipe early, wipe often
+		mac.Sum(i[:0])
+		copy(key, i[:32])
+		copy(chain, i[32:])
+	}
+	return key, chain
+}
+
+// derive derives the key pair for path from the decrypted master secret key
+// into enckey and returns the canonical path. The key number is derived from
+// the key number of the master key and the path.
+func derive(master *enckey, path string, enckey *enckey) (string, error) {
+	indices, canonical, err := parsepath(path)
+	if err != nil {
+		return "", err
+	}
+	seed, chain := derivekey(master.Seckey[:seedbytes], indices)
+	util.BzeroBytes(chain) // wipe early, wipe often
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	util.BzeroBytes(seed) // wipe early, wipe often
+	copy(enckey.Seckey[:], privateKey)
+	util.BzeroBytes(privateKey) // wipe early, wipe often
+	keynum := hash.SHA512([]byte(keynumcontext + "\x00" + string(master.Keynum[:]) + canonical))
+	copy(enckey.Keynum[:], keynum)
+	return canonical, nil
+}
+
+// generatederived writes the key pair derived for path from the master secret
+// key masterfile like generate.
+func generatederived(masterfile, path, pubkeyfile, seckeyfile string, rounds int, comment string, opts *protectopts) error {
+	var master, enckey enckey
+	util.MlockStruct(&master)
+	defer util.MunlockStruct(&master)
+	defer util.BzeroStruct(&master)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	if _, _, err := parsepath(path); err != nil {
+		return err
+	}
+	if _, err := readseckey(masterfile, &master); err != nil {
+		return err
+	}
+	if _, err := derive(&master, path, &enckey); err != nil {
+		return err
+	}
+	util.BzeroStruct(&master) // wipe early, wipe often
+	return writekeypair(pubkeyfile, seckeyfile, rounds, comment, &enckey, opts)
+}
+
+// listderived prints the path, key number and public key (in the format of
+// the second line of public key files) of the keys derived for paths from the
+// master secret key masterfile.
+func listderived(masterfile string, paths []string) error {
+	var master, enckey enckey
+	util.MlockStruct(&master)
+	defer util.MunlockStruct(&master)
+	defer util.BzeroStruct(&master)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	for _, path := range paths {
+		if _, _, err := parsepath(path); err != nil {
+			return err
+		}
+	}
+	if _, err := readseckey(masterfile, &master); err != nil {
+		return err
+	}
+	for _, path := range paths {
+		canonical, err := derive(&master, path, &enckey)
+		if err != nil {
+			return err
+		}
+		var pubkey pubkey
+		copy(pubkey.Pkalg[:], []byte(pkalg))
+		pubkey.Keynum = enckey.Keynum
+		copy(pubkey.Pubkey[:], enckey.Seckey[publicbytes:])
+		util.BzeroStruct(&enckey) // wipe early, wipe often
+		var buf bytes.Buffer
+		if err := binary.Write(&buf, binary.BigEndian, &pubkey); err != nil {
+			return err
+		}
+		fmt.Printf("%s %x %s\n", canonical, pubkey.Keynum,
+			base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+	return nil
+}
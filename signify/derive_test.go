@@ -0,0 +1,115 @@
+package signify
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	// test vector 1 for ed25519 from SLIP-0010
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	for _, v := range []struct {
+		path  []uint32
+		chain string
+		key   string
+	}{
+		{
+			nil,
+			"90046a93de5380a72b5e45010748567d5ea02bbf6522f979e05c0d8d8ca9fffb",
+			"2b4be7f19ee27bbf30c667b642d5f4aa69fd169872f8fc3059c08ebae2eb19e7",
+		},
+		{
+			[]uint32{0},
+			"8b59aa11380b624e81507a27fedda59fea6d0b779a778918a2fd3590e16e9c69",
+			"68e0fe46dfb67e368c75379acec591dad19df3cde26e63b93a8e704f1dade7a3",
+		},
+	} {
+		key, chain := derivekey(seed, v.path)
+		if hex.EncodeToString(key) != v.key || hex.EncodeToString(chain) != v.chain {
+			t.Errorf("%v: key %x, chain %x", v.path, key, chain)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	for _, path := range []string{"m/1/2026", "m/1'/2026h", "m/1'/2026'"} {
+		_, canonical, err := parsepath(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if canonical != "m/1'/2026'" {
+			t.Errorf("%s: %s", path, canonical)
+		}
+	}
+	for _, path := range []string{"m", "1/2", "m/", "m/01", "m/1''", "m/2147483648", "m/-1"} {
+		if _, _, err := parsepath(path); err == nil {
+			t.Errorf("%s: should fail", path)
+		}
+	}
+}
+
+func TestDerive(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	masterfile := filepath.Join(tmpdir, "master.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", filepath.Join(tmpdir, "master.pub"), "-s", masterfile); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := Main("signify", "-G", "-n", "-master", masterfile, "-path", "m/1/2026",
+			"-p", filepath.Join(tmpdir, name+".pub"), "-s", filepath.Join(tmpdir, name+".sec")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Main("signify", "-G", "-n", "-master", masterfile, "-path", "m/1/2027",
+		"-p", filepath.Join(tmpdir, "c.pub"), "-s", filepath.Join(tmpdir, "c.sec")); err != nil {
+		t.Fatal(err)
+	}
+	a, err := ioutil.ReadFile(filepath.Join(tmpdir, "a.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(tmpdir, "b.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := ioutil.ReadFile(filepath.Join(tmpdir, "c.pub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(a) != string(b) {
+		t.Error("derived keys differ")
+	}
+	if string(a) == string(c) {
+		t.Error("keys for different paths are equal")
+	}
+	if err := Main("signify", "-S", "-s", filepath.Join(tmpdir, "b.sec"), "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", filepath.Join(tmpdir, "a.pub"), "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", filepath.Join(tmpdir, "c.pub"), "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-derived", "-master", masterfile, "m/1/2026", "m/1/2027"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-derived", "-master", masterfile, "m/x"); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-G", "-n", "-master", masterfile,
+		"-p", filepath.Join(tmpdir, "d.pub"), "-s", filepath.Join(tmpdir, "d.sec")); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,222 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+// doctorpolicy is the minimum KDF strength the doctor accepts.
+type doctorpolicy struct {
+	rounds int    // bcrypt_pbkdf rounds
+	time   uint64 // Argon2id passes
+	memory uint64 // Argon2id memory in MiB
+}
+
+// doctor collects the findings about key pairs and signatures.
+type doctor struct {
+	findings int
+}
+
+// report prints a finding about filename.
+func (d *doctor) report(filename, format string, args ...interface{}) {
+	fmt.Printf("%s: %s\n", filename, fmt.Sprintf(format, args...))
+	d.findings++
+}
+
+// checkperms checks the permissions and the owner of the key file filename.
+func (d *doctor) checkperms(filename string, secret bool) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	mode := fi.Mode().Perm()
+	if secret && mode&077 != 0 {
+		d.report(filename, "secret key is accessible by group or others (mode %04o), run chmod 600 %s", mode, filename)
+	} else if !secret && mode&022 != 0 {
+		d.report(filename, "public key is writable by group or others (mode %04o), run chmod 644 %s", mode, filename)
+	}
+	uid, err := util.FileUID(fi)
+	if err != nil {
+		return nil // owners not supported on this platform
+	}
+	if uid != os.Getuid() && (secret || uid != 0) {
+		d.report(filename, "owned by user %d instead of %d, run chown to give it to the right user", uid, os.Getuid())
+	}
+	return nil
+}
+
+// checkfile checks the permissions, owner and comment of the key file
+// filename and returns its contents, if it could be parsed.
+func (d *doctor) checkfile(filename string, secret bool) ([]byte, error) {
+	if err := d.checkperms(filename, secret); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer util.BzeroBytes(data)
+	line := strings.SplitN(string(data), "\n", 2)[0]
+	if len(line) >= commentmaxlen {
+		d.report(filename, "comment is %d bytes long, it must be shorter than %d bytes", len(line), commentmaxlen)
+		return nil, nil
+	}
+	comment, buf, _, err := parseb64file(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	suffix := "public key"
+	if secret {
+		suffix = "secret key"
+	}
+	if !strings.HasSuffix(comment, suffix) {
+		d.report(filename, "comment %q does not end in %q, the file might not be what it seems", comment, suffix)
+	}
+	return buf, nil
+}
+
+// checkkdf checks the KDF parameters of the encrypted secret key in buf
+// against policy.
+func (d *doctor) checkkdf(filename string, buf []byte, policy *doctorpolicy) error {
+	switch string(buf[2:4]) {
+	case kdfalg:
+		rounds := int(binary.BigEndian.Uint32(buf[4:8]))
+		if rounds == 0 {
+			d.report(filename, "secret key is not protected by a passphrase, protect it with -migrate")
+		} else if rounds < policy.rounds {
+			d.report(filename, "bcrypt_pbkdf rounds %d below the minimum of %d, re-encrypt it with -migrate", rounds, policy.rounds)
+		}
+	case argonalg, keyfilealg:
+		var k enckeyv2
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &k); err != nil {
+			return err
+		}
+		time := uint64(binary.BigEndian.Uint32(k.Kdftime[:]))
+		memory := uint64(binary.BigEndian.Uint32(k.Kdfmemory[:])) / 1024
+		if time < policy.time || memory < policy.memory {
+			d.report(filename, "Argon2id parameters (time %d, memory %d MiB) below the minimum (time %d, memory %d MiB), re-encrypt it with -migrate",
+				time, memory, policy.time, policy.memory)
+		}
+	}
+	return nil
+}
+
+// checkkeys checks the secret key seckeyfile, which is decrypted, and that it
+// matches the public key pubkeyfile, if given.
+func (d *doctor) checkkeys(pubkeyfile, seckeyfile string, pubbuf, secbuf []byte) error {
+	var enckey enckey
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	var pubkey pubkey
+	if pubbuf != nil {
+		if string(pubbuf[:2]) != pkalg {
+			return fmt.Errorf("unsupported file %s", pubkeyfile)
+		}
+		if err := binary.Read(bytes.NewReader(pubbuf), binary.BigEndian, &pubkey); err != nil {
+			return fmt.Errorf("invalid public key in %s", pubkeyfile)
+		}
+		keynum, err := enckeynum(secbuf)
+		if err != nil {
+			return err
+		}
+		if keynum != pubkey.Keynum {
+			d.report(seckeyfile, "key number %x differs from key number %x of %s, they are not a key pair",
+				keynum, pubkey.Keynum, pubkeyfile)
+			return nil
+		}
+	}
+	if err := decryptseckey(secbuf, &enckey, nil); err != nil {
+		return err
+	}
+	privateKey := ed25519.NewKeyFromSeed(enckey.Seckey[:seedbytes])
+	derived := append([]byte{}, privateKey[publicbytes:]...)
+	util.BzeroBytes(privateKey) // wipe early, wipe often
+	if !bytes.Equal(derived, enckey.Seckey[publicbytes:]) {
+		d.report(seckeyfile, "secret key is corrupted, its public key does not match its seed")
+	}
+	if pubbuf != nil && !bytes.Equal(derived, pubkey.Pubkey[:]) {
+		d.report(seckeyfile, "public key derived from the secret key differs from %s, although the key numbers match", pubkeyfile)
+	}
+	return nil
+}
+
+// checksigs verifies the signature files (*.sig) in dir and its
+// subdirectories. Signatures of missing messages must have embedded ones.
+func (d *doctor) checksigs(opts *verifyopts, dir string) error {
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() || !strings.HasSuffix(path, ".sig") {
+			return nil
+		}
+		msgfile := strings.TrimSuffix(path, ".sig")
+		if regularfile(msgfile) {
+			err = verifysimple(opts, msgfile, path)
+		} else {
+			_, err = verifyembedded(opts, path)
+		}
+		if err != nil {
+			d.report(path, "signature does not verify: %s", err)
+		}
+		return nil
+	})
+}
+
+// checkup checks the key pair pubkeyfile and seckeyfile, either of which may
+// be empty, and the signatures in dirs. The findings are printed, and an error
+// is returned if there are any.
+func checkup(pubkeyfile, seckeyfile string, policy *doctorpolicy, dirs []string, opts *verifyopts) error {
+	var (
+		d      doctor
+		pubbuf []byte
+		secbuf []byte
+		err    error
+	)
+	if pubkeyfile != "" {
+		if pubbuf, err = d.checkfile(pubkeyfile, false); err != nil {
+			return err
+		}
+	}
+	if seckeyfile != "" {
+		if secbuf, err = d.checkfile(seckeyfile, true); err != nil {
+			return err
+		}
+		defer util.BzeroBytes(secbuf)
+	}
+	if secbuf != nil && string(secbuf[:2]) == pkalg {
+		_, buf, err := readenckey(seckeyfile)
+		if err != nil {
+			return err
+		}
+		defer util.BzeroBytes(buf)
+		if err := d.checkkdf(seckeyfile, buf, policy); err != nil {
+			return err
+		}
+		// skip the comparison if the public key could not be parsed
+		if pubkeyfile == "" || pubbuf != nil {
+			if err := d.checkkeys(pubkeyfile, seckeyfile, pubbuf, buf); err != nil {
+				return err
+			}
+		}
+	}
+	for _, dir := range dirs {
+		if err := d.checksigs(opts, dir); err != nil {
+			return err
+		}
+	}
+	if d.findings > 0 {
+		return fmt.Errorf("%d problems found", d.findings)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	otherpub := filepath.Join(tmpdir, "other.pub")
+	sigdir := filepath.Join(tmpdir, "release")
+	if err := os.Mkdir(sigdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	msgfile := filepath.Join(sigdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\ntopsecret\n")
+	if err := Main("signify", "-G", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", otherpub, "-s", filepath.Join(tmpdir, "other.sec")); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-doctor", "-q", "-p", pubkeyfile, "-s", seckeyfile, sigdir); err != nil {
+		t.Fatal(err)
+	}
+
+	// mismatched key pair, unprotected secret key, and a weak policy
+	if err := Main("signify", "-doctor", "-q", "-p", otherpub, "-s", seckeyfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-doctor", "-q", "-p", otherpub, "-s", filepath.Join(tmpdir, "other.sec")); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-doctor", "-q", "-minrounds", "100", "-p", otherpub, "-s", filepath.Join(tmpdir, "other.sec")); err == nil {
+		t.Error("should fail")
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-doctor", "-q", "-minrounds", "100", "-s", seckeyfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// unsafe permissions
+	if err := os.Chmod(seckeyfile, 0640); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-doctor", "-q", "-s", seckeyfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := os.Chmod(seckeyfile, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// signatures which do not verify
+	if err := Main("signify", "-doctor", "-q", "-p", otherpub, sigdir); err == nil {
+		t.Error("should fail")
+	}
+	if err := ioutil.WriteFile(msgfile, []byte("modified\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-doctor", "-q", "-p", pubkeyfile, sigdir); err == nil {
+		t.Error("should fail")
+	}
+
+	// wrong comment
+	data, err := ioutil.ReadFile(pubkeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "public key", "secret key", 1))
+	if err := ioutil.WriteFile(pubkeyfile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-doctor", "-q", "-p", pubkeyfile); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,182 @@
+package signify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	dssePayloadType = "application/octet-stream"
+	dssePAEPrefix   = "DSSEv1"
+)
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+type dsseEnvelope struct {
+	Payload     string          `json:"payload"`
+	PayloadType string          `json:"payloadType"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+// pae returns the DSSE pre-authentication encoding of payloadType and
+// payload, which is what is actually signed.
+func pae(payloadType string, payload []byte) []byte {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "%s %d %s %d ", dssePAEPrefix, len(payloadType), payloadType, len(payload))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func dssekeyid(keynum []byte) string {
+	return hex.EncodeToString(keynum)
+}
+
+// dssetype returns the payload type of payload, if none is given: in-toto
+// statements are attestations, everything else is opaque.
+func dssetype(payload []byte) string {
+	var st intotoStatement
+	if json.Unmarshal(payload, &st) == nil && st.Type == intotoStatementType {
+		return intotoPayloadType
+	}
+	return dssePayloadType
+}
+
+// signdsse signs msgfile with seckeyfile in a DSSE envelope of the given
+// payload type, which is derived from the message if empty.
+func signdsse(seckeyfile, msgfile, sigfile, payloadType string) error {
+	signer, err := newsigner(seckeyfile)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+
+	msg, err := readmsg(msgfile)
+	if err != nil {
+		return err
+	}
+	if payloadType == "" {
+		payloadType = dssetype(msg)
+	}
+
+	sig, err := signer.Sign(pae(payloadType, msg))
+	if err != nil {
+		return err
+	}
+	keynum := signer.Keynum()
+	signer.Close() // wipe early, wipe often
+	env := dsseEnvelope{
+		Payload:     base64.StdEncoding.EncodeToString(msg),
+		PayloadType: payloadType,
+		Signatures: []dsseSignature{
+			{
+				KeyID: dssekeyid(keynum[:]),
+				Sig:   base64.StdEncoding.EncodeToString(sig),
+			},
+		},
+	}
+	return writejson(sigfile, &env)
+}
+
+func writejson(filename string, v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fd, err := xopen(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if _, err := fd.Write(append(buf, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func verifydsse(pubkeyfile, msgfile, sigfile, payloadType string, embedded, quiet bool) error {
+	var (
+		env    dsseEnvelope
+		sig    sig
+		pubkey pubkey
+	)
+
+	data, err := readmsg(sigfile)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("invalid DSSE envelope in %s: %s", sigfile, err)
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return fmt.Errorf("invalid base64 encoding in %s", sigfile)
+	}
+	if payloadType == "" {
+		payloadType = dssetype(payload)
+	}
+	if env.PayloadType != payloadType {
+		return fmt.Errorf("unexpected payload type %s", env.PayloadType)
+	}
+	buf, err := readpubkey(pubkeyfile, "", pkalg)
+	if err != nil {
+		return err
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &pubkey); err != nil {
+		return err
+	}
+
+	if !embedded {
+		msg, err := readmsg(msgfile)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(msg, payload) {
+			return errors.New("message does not match DSSE payload")
+		}
+	}
+
+	// find the signature made by pubkey
+	keyid := dssekeyid(pubkey.Keynum[:])
+	found := false
+	for _, s := range env.Signatures {
+		if s.KeyID != keyid {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(s.Sig)
+		if err != nil || len(b) != sigbytes {
+			return fmt.Errorf("invalid signature in %s", sigfile)
+		}
+		copy(sig.Sig[:], b)
+		found = true
+		break
+	}
+	if !found {
+		return errors.New("verification failed: checked against wrong key")
+	}
+	copy(sig.Pkalg[:], []byte(pkalg))
+	sig.Keynum = pubkey.Keynum
+	if err := verifymsg(&pubkey, &message{buf: pae(env.PayloadType, payload)}, &sig, quiet); err != nil {
+		return err
+	}
+
+	if embedded {
+		fd, err := xopen(msgfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		if _, err := fd.Write(payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package signify
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+)
+
+func TestPAE(t *testing.T) {
+	// test vector from the DSSE protocol specification
+	exp := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if p := string(pae("http://example.com/HelloWorld", []byte("hello world"))); p != exp {
+		t.Errorf("PAE differs: %s != %s", p, exp)
+	}
+}
+
+func TestDSSE(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkey := filepath.Join(tmpdir, "key.pub")
+	seckey := filepath.Join(tmpdir, "key.sec")
+	otherpub := filepath.Join(tmpdir, "other.pub")
+	othersec := filepath.Join(tmpdir, "other.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	otherfile := filepath.Join(tmpdir, "other.txt")
+	extracted := filepath.Join(tmpdir, "extracted.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(otherfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", pubkey, "-s", seckey); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", otherpub, "-s", othersec); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-dsse", "-s", seckey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-dsse", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// extract payload
+	if err := Main("signify", "-V", "-dsse", "-q", "-e", "-p", pubkey, "-m", extracted,
+		"-x", msgfile+".dsse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(msgfile, extracted); err != nil {
+		t.Error(err)
+	}
+	// wrong key
+	if err := Main("signify", "-V", "-dsse", "-q", "-p", otherpub, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// wrong message
+	if err := Main("signify", "-V", "-dsse", "-q", "-p", pubkey, "-m", otherfile,
+		"-x", msgfile+".dsse"); err == nil {
+		t.Error("should fail")
+	}
+	// wrong payload type
+	if err := Main("signify", "-V", "-dsse", "-q", "-type", intotoPayloadType, "-p", pubkey,
+		"-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// -cose and -dsse are mutually exclusive
+	if err := Main("signify", "-S", "-dsse", "-cose", "-s", seckey, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
+
+func TestInToto(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkey := filepath.Join(tmpdir, "key.pub")
+	seckey := filepath.Join(tmpdir, "key.sec")
+	stfile := filepath.Join(tmpdir, "statement.json")
+	predicate := filepath.Join(tmpdir, "predicate.json")
+	files := []string{filepath.Join(tmpdir, "a.txt"), filepath.Join(tmpdir, "b.txt")}
+	for _, file := range files {
+		if err := createMsgfile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(predicate, []byte(`{"builder":"test"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", pubkey, "-s", seckey); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"signify", "-intoto", "-type", "https://example.com/test/v1",
+		"-predicate", predicate, "-m", stfile}
+	if err := Main(append(args, files...)...); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(stfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st intotoStatement
+	if err := json.Unmarshal(buf, &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Type != intotoStatementType || len(st.Subject) != len(files) {
+		t.Fatal("invalid statement")
+	}
+	for i, file := range files {
+		digest, err := hash.SHA256File(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Subject[i].Name != file || st.Subject[i].Digest["sha256"] != digest {
+			t.Errorf("subject %d differs", i)
+		}
+	}
+	var predbuf bytes.Buffer
+	if err := json.Compact(&predbuf, st.Predicate); err != nil {
+		t.Fatal(err)
+	}
+	if predbuf.String() != `{"builder":"test"}` {
+		t.Errorf("predicate differs: %s", predbuf.String())
+	}
+	// sign and verify the statement
+	if err := Main("signify", "-S", "-dsse", "-s", seckey, "-m", stfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-dsse", "-q", "-type", intotoPayloadType, "-p", pubkey, "-m", stfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-dsse", "-q", "-p", pubkey, "-m", stfile); err != nil {
+		t.Fatal(err)
+	}
+	// statements signed as another payload type are no attestations
+	if err := Main("signify", "-S", "-dsse", "-type", dssePayloadType, "-s", seckey, "-m", stfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-dsse", "-q", "-p", pubkey, "-m", stfile); err == nil {
+		t.Error("should fail")
+	}
+	// missing predicate type
+	if err := Main(append([]string{"signify", "-intoto", "-m", stfile}, files...)...); err == nil {
+		t.Error("should fail")
+	}
+}
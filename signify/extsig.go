@@ -0,0 +1,244 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	extsigalg     = "ES" // signature followed by a signed trusted block
+	extsigcontext = "gosignify trusted block v1\x00"
+	nscontext     = "gosignify namespace v1\x00"
+)
+
+// Keys of the trusted block set by gosignify.
+const (
+	trustedTimestamp = "timestamp"
+	trustedFile      = "file"
+	trustedExpires   = "expires"
+	trustedNamespace = "namespace"
+)
+
+// trustedopts are the contents of the trusted block of an extended signature
+// given on the command line.
+type trustedopts struct {
+	expires   time.Time // zero if the signature does not expire
+	namespace string    // namespace mixed into the signed message, if any
+	meta      []string  // additional key=value pairs
+}
+
+// namespacehead returns the bytes which are signed before the message to
+// bind the signature to namespace. Without a namespace, it is empty.
+func namespacehead(namespace string) []byte {
+	if namespace == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString(nscontext)
+	writestring(&buf, namespace)
+	return buf.Bytes()
+}
+
+// trustedblock returns the trusted block for the signature of msgfile made
+// at time now. The block consists of key=value lines.
+func trustedblock(opts *trustedopts, msgfile string, now time.Time) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s=%s\n", trustedTimestamp, now.UTC().Format(time.RFC3339))
+	if msgfile != "-" {
+		fmt.Fprintf(&b, "%s=%s\n", trustedFile, filepath.Base(msgfile))
+	}
+	if !opts.expires.IsZero() {
+		if !opts.expires.After(now) {
+			return "", errors.New("signature would already be expired")
+		}
+		fmt.Fprintf(&b, "%s=%s\n", trustedExpires, opts.expires.UTC().Format(time.RFC3339))
+	}
+	if opts.namespace != "" {
+		if strings.ContainsAny(opts.namespace, "\r\n") {
+			return "", fmt.Errorf("invalid namespace %q", opts.namespace)
+		}
+		fmt.Fprintf(&b, "%s=%s\n", trustedNamespace, opts.namespace)
+	}
+	for _, kv := range opts.meta {
+		kvs := strings.SplitN(kv, "=", 2)
+		if len(kvs) != 2 || kvs[0] == "" || strings.ContainsAny(kv, "\r\n") {
+			return "", fmt.Errorf("invalid trusted metadata %q (use key=value)", kv)
+		}
+		switch kvs[0] {
+		case trustedTimestamp, trustedFile, trustedExpires, trustedNamespace:
+			return "", fmt.Errorf("trusted metadata key %s is reserved", kvs[0])
+		}
+		fmt.Fprintf(&b, "%s\n", kv)
+	}
+	if b.Len() > 0xffff {
+		return "", errors.New("trusted metadata too long")
+	}
+	return b.String(), nil
+}
+
+// parsetrusted parses the trusted block into key=value pairs.
+func parsetrusted(block string) ([][2]string, error) {
+	var kvs [][2]string
+	for _, line := range strings.SplitAfter(block, "\n") {
+		if line == "" {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSuffix(line, "\n"), "=", 2)
+		if len(kv) != 2 || !strings.HasSuffix(line, "\n") {
+			return nil, errors.New("invalid trusted block")
+		}
+		kvs = append(kvs, [2]string{kv[0], kv[1]})
+	}
+	return kvs, nil
+}
+
+// extsigmsg returns the message signed by the global signature of an
+// extended signature.
+func extsigmsg(s *sig, block string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(extsigcontext)
+	buf.Write(s.Sig[:])
+	writestring(&buf, block)
+	return buf.Bytes()
+}
+
+// extsign signs the trusted block together with the signature s of the
+// message and returns the extended signature.
+func extsign(signer signer, s *sig, block string) ([]byte, error) {
+	global, err := signer.Sign(extsigmsg(s, block))
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBufferString(extsigalg)
+	if err := binary.Write(buf, binary.BigEndian, s); err != nil {
+		return nil, err
+	}
+	buf.Write(global)
+	writestring(buf, block)
+	return buf.Bytes(), nil
+}
+
+// splitextsig splits an extended signature into the signature of the
+// message, the global signature, and the trusted block.
+func splitextsig(buf []byte) (*sig, []byte, string, error) {
+	s := new(sig)
+	r := bytes.NewReader(buf[len(extsigalg):])
+	if err := binary.Read(r, binary.BigEndian, s); err != nil {
+		return nil, nil, "", errors.New("invalid signature")
+	}
+	if string(s.Pkalg[:]) != pkalg {
+		return nil, nil, "", errors.New("unsupported signature algorithm")
+	}
+	global := make([]byte, sigbytes)
+	if _, err := r.Read(global); err != nil || r.Len() < 2 {
+		return nil, nil, "", errors.New("invalid signature")
+	}
+	block, err := readstring(r)
+	if err != nil || r.Len() != 0 {
+		return nil, nil, "", errors.New("invalid signature")
+	}
+	return s, global, block, nil
+}
+
+// checknamespace returns the namespace recorded in the trusted block, which
+// must be the namespace the signature is verified for.
+func checknamespace(kvs [][2]string, namespace string) (string, error) {
+	var ns string
+	for _, kv := range kvs {
+		if kv[0] == trustedNamespace {
+			ns = kv[1]
+		}
+	}
+	switch {
+	case ns == namespace:
+		return ns, nil
+	case namespace == "":
+		return "", fmt.Errorf("signature made in namespace %s (use -namespace)", ns)
+	case ns == "":
+		return "", fmt.Errorf("signature not made in namespace %s", namespace)
+	default:
+		return "", fmt.Errorf("signature made in namespace %s, not %s", ns, namespace)
+	}
+}
+
+// checktrusted checks the expiry and the file name of the trusted block. If
+// strict is false, violations are only reported as warnings.
+func checktrusted(kvs [][2]string, now time.Time, name string, strict bool) error {
+	var errs []string
+	for _, kv := range kvs {
+		switch kv[0] {
+		case trustedExpires:
+			t, err := time.Parse(time.RFC3339, kv[1])
+			if err != nil {
+				return errors.New("invalid expiry in trusted block")
+			}
+			if now.After(t) {
+				errs = append(errs, fmt.Sprintf("signature expired at %s", kv[1]))
+			}
+		case trustedFile:
+			if name != "-" && kv[1] != filepath.Base(name) {
+				errs = append(errs, fmt.Sprintf("signature made for file %s", kv[1]))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	if strict {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", argv0, e)
+	}
+	return nil
+}
+
+// verifyextsig verifies msg, named name, against the extended signature in
+// buf and shows the trusted block unless opts.quiet is set.
+func verifyextsig(opts *verifyopts, key *pubkey, name string, buf []byte, msg *message) error {
+	s, global, block, err := splitextsig(buf)
+	if err != nil {
+		return err
+	}
+	if len(opts.chain) > 0 {
+		if key, err = chainkey(key, opts.chain, s.Keynum, opts.revocations); err != nil {
+			return err
+		}
+	}
+	if err := opts.checkrevoked(s.Keynum); err != nil {
+		return err
+	}
+	if s.Keynum != key.Keynum {
+		return errors.New("verification failed: checked against wrong key")
+	}
+	if !ed25519.Verify(key.Pubkey[:], extsigmsg(s, block), global) {
+		return errors.New("trusted block verification failed")
+	}
+	kvs, err := parsetrusted(block)
+	if err != nil {
+		return err
+	}
+	ns, err := checknamespace(kvs, opts.namespace)
+	if err != nil {
+		return err
+	}
+	if err := checktrusted(kvs, time.Now(), name, opts.strict); err != nil {
+		return err
+	}
+	if err := verifymsg(key, msg.withhead(namespacehead(ns)), s, opts.quiet); err != nil {
+		return err
+	}
+	if !opts.quiet {
+		for _, kv := range kvs {
+			fmt.Printf("trusted %s: %s\n", kv[0], kv[1])
+		}
+	}
+	return nil
+}
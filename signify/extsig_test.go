@@ -0,0 +1,193 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtendedSignature(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	renamed := filepath.Join(tmpdir, "renamed.txt")
+	sigfile := msgfile + ".sig"
+	if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-t", "-meta", "build=42", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-strict", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	_, buf, err := readb64file(sigfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _, block, err := splitextsig(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kvs, err := parsetrusted(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kvs) != 3 || kvs[0][0] != trustedTimestamp || kvs[1] != [2]string{trustedFile, "message.txt"} ||
+		kvs[2] != [2]string{"build", "42"} {
+		t.Errorf("unexpected trusted block %q", block)
+	}
+	// the signature of the message is an ordinary signature
+	var pk pubkey
+	if err := readpubkeyfile(pubkeyfile, &pk); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ioutil.ReadFile(msgfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifymsg(&pk, &message{buf: msg}, s, true); err != nil {
+		t.Error(err)
+	}
+
+	// file name binding is only enforced with -strict
+	if err := os.Rename(msgfile, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", renamed, "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-strict", "-p", pubkeyfile, "-m", renamed, "-x", sigfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := os.Rename(renamed, msgfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// tampered trusted block
+	tampered := filepath.Join(tmpdir, "tampered.sig")
+	global := make([]byte, sigbytes)
+	copy(global, buf[2+len(s.Pkalg)+len(s.Keynum)+len(s.Sig):])
+	forged, err := extsign(&fixedsigner{sig: global}, s, block+"approved=yes\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeb64file(tampered, "tampered", forged, nil, os.O_EXCL, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile, "-x", tampered); err == nil {
+		t.Error("should fail")
+	}
+
+	// expiry
+	expire := time.Now().Add(time.Hour).Format(time.RFC3339)
+	if err := Main("signify", "-S", "-expire", expire, "-e", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-strict", "-e", "-p", pubkeyfile,
+		"-m", filepath.Join(tmpdir, "message"), "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	kvs = [][2]string{{trustedExpires, expire}}
+	if err := checktrusted(kvs, time.Now().Add(2*time.Hour), msgfile, true); err == nil {
+		t.Error("should fail")
+	}
+	if err := checktrusted(kvs, time.Now().Add(2*time.Hour), msgfile, false); err != nil {
+		t.Error(err)
+	}
+	if err := Main("signify", "-S", "-expire", "2000-01-01", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// reserved keys
+	if err := Main("signify", "-S", "-meta", "file=other", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
+
+// fixedsigner returns a fixed signature.
+type fixedsigner struct {
+	sig []byte
+}
+
+func (s *fixedsigner) Keynum() [keynumlen]byte         { return [keynumlen]byte{} }
+func (s *fixedsigner) Comment() string                 { return "" }
+func (s *fixedsigner) Sign(msg []byte) ([]byte, error) { return s.sig, nil }
+func (s *fixedsigner) Close() error                    { return nil }
+
+func TestNamespace(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	sigfile := msgfile + ".sig"
+	plainsig := filepath.Join(tmpdir, "plain.sig")
+	if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-namespace", "release", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "firmware", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// the namespace is part of the signed message
+	_, buf, err := readb64file(sigfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _, _, err := splitextsig(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pk pubkey
+	if err := readpubkeyfile(pubkeyfile, &pk); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ioutil.ReadFile(msgfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifymsg(&pk, &message{buf: msg}, s, true); err == nil {
+		t.Error("should fail")
+	}
+	if err := verifymsg(&pk, &message{head: namespacehead("firmware"), buf: msg}, s, true); err == nil {
+		t.Error("should fail")
+	}
+	// signatures without a namespace
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile, "-x", plainsig); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-p", pubkeyfile,
+		"-m", msgfile, "-x", plainsig); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-S", "-t", "-x", sigfile, "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,671 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/frost"
+	"github.com/frankbraun/gosignify/internal/hash"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+// File types of FROST threshold signing.
+const (
+	frostdkgalg    = "FD" // secret state during key generation
+	frostsharealg  = "FS" // secret signing share
+	frostnoncealg  = "FN" // secret signing nonces
+	frostround1alg = "F1" // public key generation package
+	frostround2alg = "F2" // encrypted secret shares
+	frostcommitalg = "FC" // signing commitment
+	frostsigalg    = "FZ" // signature share
+)
+
+// frostkey is the header of FROST secret files and of secret key shares. It
+// is followed by the secret data, which is encrypted like the secret key of an
+// enckey.
+type frostkey struct {
+	Pkalg        [2]byte
+	Kdfalg       [2]byte
+	Kdfrounds    [4]byte
+	Salt         [16]byte
+	Checksum     [8]byte
+	Keynum       [keynumlen]byte // of the group key, zero during key generation
+	ID           uint16
+	Threshold    uint16
+	Participants uint16
+	Groupkey     [publicbytes]byte
+}
+
+type frostround1 struct {
+	Pkalg        [2]byte
+	ID           uint16
+	Threshold    uint16
+	Participants uint16
+	Exchange     frost.Element
+	ProofR       frost.Element
+	ProofZ       frost.Scalar
+	// followed by Threshold commitments
+}
+
+type frostround2 struct {
+	Pkalg [2]byte
+	From  uint16
+	// followed by encrypted shares
+}
+
+type frostshare struct {
+	To         uint16
+	Ciphertext [frost.EncryptedShareSize]byte
+}
+
+type frostcommit struct {
+	Pkalg   [2]byte
+	Keynum  [keynumlen]byte
+	ID      uint16
+	Hiding  frost.Element
+	Binding frost.Element
+}
+
+type frostsig struct {
+	Pkalg  [2]byte
+	Keynum [keynumlen]byte
+	ID     uint16
+	Share  frost.Scalar
+}
+
+// frostpass reads the passphrase for FROST secret files protected with the
+// given number of rounds. The caller must wipe and unlock it.
+func frostpass(rounds int, confirm bool) ([]byte, error) {
+	if rounds == 0 {
+		return nil, nil
+	}
+	return readpassphrase("passphrase", confirm)
+}
+
+// sealsecret encrypts secret with pass and rounds under a new salt, which is
+// stored in salt together with the checksum of secret, and returns it. The
+// result is locked to memory and must be wiped and unlocked by the caller.
+func sealsecret(salt, checksum, secret, pass []byte, rounds int) ([]byte, error) {
+	xorkey := make([]byte, len(secret))
+	util.MlockBytes(xorkey)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		util.MunlockBytes(xorkey)
+		return nil, err
+	}
+	kdfpass(pass, salt, rounds, xorkey)
+	digest := hash.SHA512(secret)
+	copy(checksum, digest)
+	util.BzeroBytes(digest)
+	for i := range xorkey {
+		xorkey[i] ^= secret[i]
+	}
+	return xorkey, nil
+}
+
+// opensecret decrypts secret, which was encrypted by sealsecret, with pass in
+// place.
+func opensecret(salt, checksum, secret, pass []byte, rounds int) error {
+	xorkey := make([]byte, len(secret))
+	util.MlockBytes(xorkey)
+	defer util.MunlockBytes(xorkey)
+	defer util.BzeroBytes(xorkey)
+
+	kdfpass(pass, salt, rounds, xorkey)
+	for i := range secret {
+		secret[i] ^= xorkey[i]
+	}
+	digest := hash.SHA512(secret)
+	defer util.BzeroBytes(digest)
+	if !bytes.Equal(checksum, digest[:len(checksum)]) {
+		util.BzeroBytes(secret)
+		return errors.New("incorrect passphrase")
+	}
+	return nil
+}
+
+// writefrostkey encrypts secret with pass and writes it with the header key to
+// filename.
+func writefrostkey(filename, comment string, key *frostkey, secret, pass []byte, rounds, oflags int) error {
+	copy(key.Kdfalg[:], []byte(kdfalg))
+	binary.BigEndian.PutUint32(key.Kdfrounds[:], uint32(rounds))
+	enc, err := sealsecret(key.Salt[:], key.Checksum[:], secret, pass, rounds)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(enc)
+	defer util.BzeroBytes(enc)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, key); err != nil {
+		return err
+	}
+	buf.Write(enc)
+	defer util.BzeroBytes(buf.Bytes())
+	return writeb64file(filename, comment, buf.Bytes(), nil, oflags, 0600)
+}
+
+// readfrostkey reads the still encrypted FROST secret file filename of type
+// alg into key and returns the encrypted secret data.
+func readfrostkey(filename, alg string, key *frostkey) ([]byte, error) {
+	_, buf, err := readb64file(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, key); err != nil {
+		return nil, fmt.Errorf("invalid file %s", filename)
+	}
+	if string(key.Pkalg[:]) != alg {
+		return nil, fmt.Errorf("unexpected file type in %s", filename)
+	}
+	if string(key.Kdfalg[:]) != kdfalg {
+		return nil, errors.New("unsupported KDF")
+	}
+	return buf[len(buf)-r.Len():], nil
+}
+
+// decryptfrostkey decrypts secret, which belongs to key, with pass in place.
+func decryptfrostkey(key *frostkey, secret, pass []byte) error {
+	rounds := binary.BigEndian.Uint32(key.Kdfrounds[:])
+	return opensecret(key.Salt[:], key.Checksum[:], secret, pass, int(rounds))
+}
+
+// readfrostshare reads and decrypts the secret signing share in sharefile.
+// The returned passphrase must be wiped and unlocked by the caller.
+func readfrostshare(sharefile string, key *frostkey, share *frost.Scalar) ([]byte, error) {
+	secret, err := readfrostkey(sharefile, frostsharealg, key)
+	if err != nil {
+		return nil, err
+	}
+	defer util.BzeroBytes(secret)
+	if len(secret) != len(share) {
+		return nil, fmt.Errorf("invalid file %s", sharefile)
+	}
+	pass, err := frostpass(int(binary.BigEndian.Uint32(key.Kdfrounds[:])), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := decryptfrostkey(key, secret, pass); err != nil {
+		util.BzeroBytes(pass)
+		util.MunlockBytes(pass)
+		return nil, err
+	}
+	copy(share[:], secret)
+	return pass, nil
+}
+
+// readfrostfiles reads the public FROST files and returns their contents by
+// file type.
+func readfrostfiles(files []string) (map[string][][]byte, error) {
+	contents := make(map[string][][]byte)
+	for _, file := range files {
+		_, buf, err := readb64file(file)
+		if err != nil {
+			return nil, err
+		}
+		alg := string(buf[:2])
+		switch alg {
+		case frostround1alg, frostround2alg, frostcommitalg, frostsigalg:
+			contents[alg] = append(contents[alg], buf)
+		default:
+			return nil, fmt.Errorf("unexpected file type in %s", file)
+		}
+	}
+	return contents, nil
+}
+
+func parseround1(buf []byte) (*frost.DKGPackage, error) {
+	var hdr frostround1
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	pkg := &frost.DKGPackage{
+		ID:          hdr.ID,
+		Commitments: make([]frost.Element, r.Len()/frost.ElementSize),
+		ProofR:      hdr.ProofR,
+		ProofZ:      hdr.ProofZ,
+		Exchange:    hdr.Exchange,
+	}
+	if len(pkg.Commitments) != int(hdr.Threshold) || r.Len()%frost.ElementSize != 0 {
+		return nil, errors.New("invalid key generation package")
+	}
+	if err := binary.Read(r, binary.BigEndian, pkg.Commitments); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+func parseround2(buf []byte) ([]frost.EncryptedShare, error) {
+	var hdr frostround2
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	var s frostshare
+	if r.Len()%binary.Size(&s) != 0 {
+		return nil, errors.New("invalid secret share package")
+	}
+	var shares []frost.EncryptedShare
+	for r.Len() > 0 {
+		if err := binary.Read(r, binary.BigEndian, &s); err != nil {
+			return nil, err
+		}
+		shares = append(shares, frost.EncryptedShare{From: hdr.From, To: s.To, Ciphertext: s.Ciphertext})
+	}
+	return shares, nil
+}
+
+func marshaldkgsecret(secret *frost.DKGSecret) []byte {
+	var buf []byte
+	for _, c := range secret.Coefficients {
+		buf = append(buf, c[:]...)
+	}
+	return append(buf, secret.Exchange[:]...)
+}
+
+// readdkgsecret reads and decrypts the key generation state in statefile.
+// The returned passphrase must be wiped and unlocked by the caller.
+func readdkgsecret(statefile string, key *frostkey, secret *frost.DKGSecret) ([]byte, error) {
+	buf, err := readfrostkey(statefile, frostdkgalg, key)
+	if err != nil {
+		return nil, err
+	}
+	defer util.BzeroBytes(buf)
+	if len(buf) != (int(key.Threshold)+1)*frost.ScalarSize {
+		return nil, fmt.Errorf("invalid file %s", statefile)
+	}
+	pass, err := frostpass(int(binary.BigEndian.Uint32(key.Kdfrounds[:])), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := decryptfrostkey(key, buf, pass); err != nil {
+		util.BzeroBytes(pass)
+		util.MunlockBytes(pass)
+		return nil, err
+	}
+	secret.Coefficients = make([]frost.Scalar, key.Threshold)
+	for i := range secret.Coefficients {
+		copy(secret.Coefficients[i][:], buf[i*frost.ScalarSize:])
+	}
+	copy(secret.Exchange[:], buf[len(buf)-frost.ScalarSize:])
+	return pass, nil
+}
+
+func wipedkgsecret(secret *frost.DKGSecret) {
+	for i := range secret.Coefficients {
+		util.BzeroBytes(secret.Coefficients[i][:])
+	}
+	util.BzeroBytes(secret.Exchange[:])
+}
+
+// dkground1 starts the distributed key generation of participant id of n
+// participants with threshold t. The secret state is written to statefile,
+// the public package for the other participants to outfile.
+func dkground1(statefile, outfile string, id, t, n, rounds int) error {
+	if id < 1 || id > frost.MaxParticipants || n > frost.MaxParticipants {
+		return fmt.Errorf("participant id not in range 1..%d", n)
+	}
+	secret, pkg, err := frost.DKGRound1(rand.Reader, uint16(id), t, n)
+	if err != nil {
+		return err
+	}
+	defer wipedkgsecret(secret)
+
+	pass, err := frostpass(rounds, true)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(pass)
+	defer util.BzeroBytes(pass)
+	key := frostkey{ID: uint16(id), Threshold: uint16(t), Participants: uint16(n)}
+	copy(key.Pkalg[:], []byte(frostdkgalg))
+	buf := marshaldkgsecret(secret)
+	defer util.BzeroBytes(buf)
+	comment := fmt.Sprintf("key generation state of participant %d", id)
+	if err := writefrostkey(statefile, comment, &key, buf, pass, rounds, os.O_EXCL); err != nil {
+		return err
+	}
+
+	r1 := frostround1{
+		ID:           pkg.ID,
+		Threshold:    uint16(t),
+		Participants: uint16(n),
+		Exchange:     pkg.Exchange,
+		ProofR:       pkg.ProofR,
+		ProofZ:       pkg.ProofZ,
+	}
+	copy(r1.Pkalg[:], []byte(frostround1alg))
+	var out bytes.Buffer
+	if err := binary.Write(&out, binary.BigEndian, &r1); err != nil {
+		return err
+	}
+	if err := binary.Write(&out, binary.BigEndian, pkg.Commitments); err != nil {
+		return err
+	}
+	comment = fmt.Sprintf("key generation package of participant %d", id)
+	return writeb64file(outfile, comment, out.Bytes(), nil, os.O_TRUNC, 0666)
+}
+
+// dkgpackages parses the key generation packages in contents and makes sure
+// they match the parameters in key.
+func dkgpackages(key *frostkey, contents map[string][][]byte) ([]*frost.DKGPackage, error) {
+	var pkgs []*frost.DKGPackage
+	for _, buf := range contents[frostround1alg] {
+		pkg, err := parseround1(buf)
+		if err != nil {
+			return nil, err
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	if len(pkgs) != int(key.Participants) {
+		return nil, fmt.Errorf("need key generation packages of all %d participants", key.Participants)
+	}
+	return pkgs, nil
+}
+
+// dkground2 verifies the key generation packages in files and writes the
+// encrypted secret shares for the other participants to outfile.
+func dkground2(statefile, outfile string, files []string) error {
+	var (
+		key    frostkey
+		secret frost.DKGSecret
+	)
+	contents, err := readfrostfiles(files)
+	if err != nil {
+		return err
+	}
+	pass, err := readdkgsecret(statefile, &key, &secret)
+	if err != nil {
+		return err
+	}
+	util.BzeroBytes(pass)
+	util.MunlockBytes(pass)
+	defer wipedkgsecret(&secret)
+	pkgs, err := dkgpackages(&key, contents)
+	if err != nil {
+		return err
+	}
+	shares, err := frost.DKGRound2(&secret, key.ID, pkgs)
+	if err != nil {
+		return err
+	}
+
+	r2 := frostround2{From: key.ID}
+	copy(r2.Pkalg[:], []byte(frostround2alg))
+	var out bytes.Buffer
+	if err := binary.Write(&out, binary.BigEndian, &r2); err != nil {
+		return err
+	}
+	for _, share := range shares {
+		s := frostshare{To: share.To, Ciphertext: share.Ciphertext}
+		if err := binary.Write(&out, binary.BigEndian, &s); err != nil {
+			return err
+		}
+	}
+	comment := fmt.Sprintf("secret shares of participant %d", key.ID)
+	return writeb64file(outfile, comment, out.Bytes(), nil, os.O_TRUNC, 0666)
+}
+
+// dkground3 verifies the secret shares in files, writes the group public key
+// to pubkeyfile and replaces the key generation state in statefile with the
+// secret signing share.
+func dkground3(pubkeyfile, statefile, comment string, files []string) error {
+	var (
+		key    frostkey
+		secret frost.DKGSecret
+		pubkey pubkey
+	)
+	contents, err := readfrostfiles(files)
+	if err != nil {
+		return err
+	}
+	pass, err := readdkgsecret(statefile, &key, &secret)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(pass)
+	defer util.BzeroBytes(pass)
+	defer wipedkgsecret(&secret)
+	pkgs, err := dkgpackages(&key, contents)
+	if err != nil {
+		return err
+	}
+	var shares []frost.EncryptedShare
+	for _, buf := range contents[frostround2alg] {
+		s, err := parseround2(buf)
+		if err != nil {
+			return err
+		}
+		shares = append(shares, s...)
+	}
+	share, groupkey, err := frost.DKGRound3(&secret, key.ID, pkgs, shares)
+	if err != nil {
+		return err
+	}
+	defer util.BzeroBytes(share[:])
+
+	// all participants derive the same key number from the group key
+	copy(pubkey.Pkalg[:], []byte(pkalg))
+	copy(pubkey.Keynum[:], hash.SHA512(groupkey[:]))
+	copy(pubkey.Pubkey[:], groupkey[:])
+	commentbuf := fmt.Sprintf("%s public key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	if err := writeb64file(pubkeyfile, commentbuf, &pubkey, nil, os.O_EXCL, 0666); err != nil {
+		return err
+	}
+
+	copy(key.Pkalg[:], []byte(frostsharealg))
+	key.Keynum = pubkey.Keynum
+	key.Groupkey = pubkey.Pubkey
+	rounds := int(binary.BigEndian.Uint32(key.Kdfrounds[:]))
+	commentbuf = fmt.Sprintf("%s secret share %d of %d", comment, key.ID, key.Participants)
+	return writefrostkey(statefile, commentbuf, &key, share[:], pass, rounds, os.O_TRUNC)
+}
+
+// noncefile returns the name of the file holding the secret nonces of the
+// signing commitment in commitfile.
+func noncefile(commitfile string) string {
+	return commitfile + ".nonce"
+}
+
+// frostcommitment creates the signing commitment for the secret signing share
+// in sharefile and writes it to commitfile. The secret nonces are written to
+// the nonce file of commitfile.
+func frostcommitment(sharefile, commitfile string) error {
+	var (
+		key   frostkey
+		share frost.Scalar
+	)
+	pass, err := readfrostshare(sharefile, &key, &share)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(pass)
+	defer util.BzeroBytes(pass)
+	defer util.BzeroBytes(share[:])
+	nonces, commitment, err := frost.Commit(rand.Reader, key.ID, share)
+	if err != nil {
+		return err
+	}
+	secret := append(nonces.Hiding[:], nonces.Binding[:]...)
+	defer util.BzeroBytes(secret)
+	util.BzeroStruct(nonces)
+
+	nkey := frostkey{
+		Keynum:       key.Keynum,
+		ID:           key.ID,
+		Threshold:    key.Threshold,
+		Participants: key.Participants,
+		Groupkey:     key.Groupkey,
+	}
+	copy(nkey.Pkalg[:], []byte(frostnoncealg))
+	rounds := int(binary.BigEndian.Uint32(key.Kdfrounds[:]))
+	comment := fmt.Sprintf("signing nonces of participant %d", key.ID)
+	if err := writefrostkey(noncefile(commitfile), comment, &nkey, secret, pass, rounds, os.O_EXCL); err != nil {
+		return err
+	}
+
+	c := frostcommit{Keynum: key.Keynum, ID: key.ID, Hiding: commitment.Hiding, Binding: commitment.Binding}
+	copy(c.Pkalg[:], []byte(frostcommitalg))
+	comment = fmt.Sprintf("signing commitment of participant %d", key.ID)
+	return writeb64file(commitfile, comment, &c, nil, os.O_TRUNC, 0666)
+}
+
+// frostcommitments parses the signing commitments for the key keynum.
+func frostcommitments(keynum [keynumlen]byte, bufs [][]byte) ([]frost.Commitment, error) {
+	var commitments []frost.Commitment
+	for _, buf := range bufs {
+		var c frostcommit
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &c); err != nil {
+			return nil, err
+		}
+		if c.Keynum != keynum {
+			return nil, fmt.Errorf("commitment of participant %d is for another key", c.ID)
+		}
+		commitments = append(commitments, frost.Commitment{ID: c.ID, Hiding: c.Hiding, Binding: c.Binding})
+	}
+	return commitments, nil
+}
+
+// frostsign computes the signature share for msgfile with the secret signing
+// share in sharefile and writes it to outfile. files must contain the signing
+// commitments of all signing participants. The secret nonces belonging to
+// the own commitment are destroyed, so that they cannot be used again.
+func frostsign(sharefile, msgfile, outfile string, files []string) error {
+	var (
+		key    frostkey
+		nkey   frostkey
+		share  frost.Scalar
+		nonces frost.Nonces
+	)
+	msg, err := readmsg(msgfile)
+	if err != nil {
+		return err
+	}
+	pass, err := readfrostshare(sharefile, &key, &share)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(pass)
+	defer util.BzeroBytes(pass)
+	defer util.BzeroBytes(share[:])
+
+	var (
+		commitments []frost.Commitment
+		ownfile     string
+	)
+	for _, file := range files {
+		contents, err := readfrostfiles([]string{file})
+		if err != nil {
+			return err
+		}
+		c, err := frostcommitments(key.Keynum, contents[frostcommitalg])
+		if err != nil {
+			return err
+		}
+		if len(c) != 1 {
+			return fmt.Errorf("%s is not a signing commitment", file)
+		}
+		if c[0].ID == key.ID {
+			ownfile = file
+		}
+		commitments = append(commitments, c[0])
+	}
+	if len(commitments) < int(key.Threshold) {
+		return fmt.Errorf("need signing commitments of at least %d participants", key.Threshold)
+	}
+	if ownfile == "" {
+		return errors.New("own signing commitment missing")
+	}
+
+	secret, err := readfrostkey(noncefile(ownfile), frostnoncealg, &nkey)
+	if err != nil {
+		return err
+	}
+	defer util.BzeroBytes(secret)
+	if len(secret) != 2*frost.ScalarSize || nkey.Keynum != key.Keynum || nkey.ID != key.ID {
+		return fmt.Errorf("invalid file %s", noncefile(ownfile))
+	}
+	if err := decryptfrostkey(&nkey, secret, pass); err != nil {
+		return err
+	}
+	copy(nonces.Hiding[:], secret)
+	copy(nonces.Binding[:], secret[frost.ScalarSize:])
+	defer util.BzeroStruct(&nonces)
+	// never use the nonces twice
+	if err := os.Remove(noncefile(ownfile)); err != nil {
+		return err
+	}
+
+	var groupkey frost.Element
+	copy(groupkey[:], key.Groupkey[:])
+	s, err := frost.Sign(key.ID, share, groupkey, &nonces, commitments, msg)
+	if err != nil {
+		return err
+	}
+	z := frostsig{Keynum: key.Keynum, ID: s.ID, Share: s.Share}
+	copy(z.Pkalg[:], []byte(frostsigalg))
+	comment := fmt.Sprintf("signature share of participant %d", key.ID)
+	return writeb64file(outfile, comment, &z, nil, os.O_TRUNC, 0666)
+}
+
+// frostaggregate combines the signing commitments and signature shares in
+// files into an ordinary signature of msgfile made with the group key in
+// pubkeyfile.
+func frostaggregate(pubkeyfile, msgfile, sigfile string, embedded bool, files []string) error {
+	var (
+		pubkey pubkey
+		sig    sig
+	)
+	msg, err := readmsg(msgfile)
+	if err != nil {
+		return err
+	}
+	if err := readpubkeyfile(pubkeyfile, &pubkey); err != nil {
+		return err
+	}
+	contents, err := readfrostfiles(files)
+	if err != nil {
+		return err
+	}
+	commitments, err := frostcommitments(pubkey.Keynum, contents[frostcommitalg])
+	if err != nil {
+		return err
+	}
+	var shares []frost.SignatureShare
+	for _, buf := range contents[frostsigalg] {
+		var z frostsig
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &z); err != nil {
+			return err
+		}
+		if z.Keynum != pubkey.Keynum {
+			return fmt.Errorf("signature share of participant %d is for another key", z.ID)
+		}
+		shares = append(shares, frost.SignatureShare{ID: z.ID, Share: z.Share})
+	}
+	var groupkey frost.Element
+	copy(groupkey[:], pubkey.Pubkey[:])
+	s, err := frost.Aggregate(groupkey, commitments, shares, msg)
+	if err != nil {
+		return err
+	}
+
+	copy(sig.Pkalg[:], []byte(pkalg))
+	sig.Keynum = pubkey.Keynum
+	copy(sig.Sig[:], s)
+	sigcomment := fmt.Sprintf("%s%s", verifywith, pubkeyfile)
+	if len(sigcomment) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	if !embedded {
+		msg = nil
+	}
+	return writeb64file(sigfile, sigcomment, &sig, msg, os.O_TRUNC, 0666)
+}
@@ -0,0 +1,100 @@
+package signify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFROST(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	file := func(format string, a ...interface{}) string {
+		return filepath.Join(tmpdir, fmt.Sprintf(format, a...))
+	}
+	pubkey := file("group.pub")
+	msgfile := file("message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// distributed key generation of a 2-of-3 key
+	var round1, round2 []string
+	for i := 1; i <= 3; i++ {
+		if err := Main("signify", "-dkg", "-round", "1", "-n", "-id", fmt.Sprint(i),
+			"-threshold", "2", "-participants", "3", "-s", file("share%d.sec", i),
+			"-x", file("round1.%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		round1 = append(round1, file("round1.%d", i))
+	}
+	// packages of all participants are required
+	if err := Main(append([]string{"signify", "-dkg", "-round", "2", "-s", file("share1.sec"),
+		"-x", file("round2.1")}, round1[:2]...)...); err == nil {
+		t.Error("should fail")
+	}
+	for i := 1; i <= 3; i++ {
+		if err := Main(append([]string{"signify", "-dkg", "-round", "2", "-s", file("share%d.sec", i),
+			"-x", file("round2.%d", i)}, round1...)...); err != nil {
+			t.Fatal(err)
+		}
+		round2 = append(round2, file("round2.%d", i))
+	}
+	for i := 1; i <= 3; i++ {
+		pub := pubkey
+		if i > 1 {
+			pub = file("group%d.pub", i)
+		}
+		args := []string{"signify", "-dkg", "-round", "3", "-p", pub, "-s", file("share%d.sec", i)}
+		args = append(append(args, round1...), round2...)
+		if err := Main(args...); err != nil {
+			t.Fatal(err)
+		}
+		if i > 1 {
+			if err := diff(pubkey, pub); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// participants 1 and 3 sign
+	signers := []int{1, 3}
+	var commitments, sigshares []string
+	for _, i := range signers {
+		if err := Main("signify", "-frost", "-round", "1", "-s", file("share%d.sec", i),
+			"-x", file("commit.%d", i)); err != nil {
+			t.Fatal(err)
+		}
+		commitments = append(commitments, file("commit.%d", i))
+	}
+	for _, i := range signers {
+		if err := Main(append([]string{"signify", "-frost", "-round", "2", "-s", file("share%d.sec", i),
+			"-m", msgfile, "-x", file("sigshare.%d", i)}, commitments...)...); err != nil {
+			t.Fatal(err)
+		}
+		sigshares = append(sigshares, file("sigshare.%d", i))
+	}
+	// nonces cannot be used twice
+	if err := Main(append([]string{"signify", "-frost", "-round", "2", "-s", file("share1.sec"),
+		"-m", msgfile, "-x", file("sigshare.again")}, commitments...)...); err == nil {
+		t.Error("should fail")
+	}
+	// a single signature share is not enough
+	if err := Main("signify", "-frost", "-round", "3", "-p", pubkey, "-m", msgfile,
+		commitments[0], sigshares[0]); err == nil {
+		t.Error("should fail")
+	}
+	args := []string{"signify", "-frost", "-round", "3", "-p", pubkey, "-m", msgfile}
+	if err := Main(append(append(args, commitments...), sigshares...)...); err != nil {
+		t.Fatal(err)
+	}
+	// the result is an ordinary signature of the group key
+	if err := Main("signify", "-V", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,298 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/mldsa"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+const (
+	hybridalg        = "EM" // Ed25519 and ML-DSA-65 (FIPS 204)
+	hybridcontext    = "gosignify hybrid v1"
+	mldsaseedbytes   = mldsa.PrivateKeySize
+	mldsapublicbytes = mldsa.MLDSA65PublicKeySize
+	mldsasigbytes    = mldsa.MLDSA65SignatureSize
+)
+
+// hybridenckey is the secret key of a hybrid key. The Ed25519 secret key
+// and the ML-DSA-65 seed are encrypted together with the output of the KDF.
+type hybridenckey struct {
+	Pkalg     [2]byte
+	Kdfalg    [2]byte
+	Kdfrounds [4]byte
+	Salt      [16]byte
+	Checksum  [8]byte
+	Keynum    [keynumlen]byte
+	Seckey    [secretbytes]byte
+	Mlseed    [mldsaseedbytes]byte
+}
+
+type hybridpubkey struct {
+	Pkalg    [2]byte
+	Keynum   [keynumlen]byte
+	Pubkey   [publicbytes]byte
+	Mlpubkey [mldsapublicbytes]byte
+}
+
+// hybridsig is a hybrid signature, which is only valid if both signatures
+// are valid.
+type hybridsig struct {
+	Pkalg  [2]byte
+	Keynum [keynumlen]byte
+	Sig    [sigbytes]byte
+	Mlsig  [mldsasigbytes]byte
+}
+
+// hybridhead is signed by the Ed25519 key before the message, so the Ed25519
+// signature cannot be taken for an ordinary signature.
+var hybridhead = []byte(hybridcontext + "\x00")
+
+// secret returns the secret key material of k, which is encrypted.
+func (k *hybridenckey) secret() []byte {
+	return append(k.Seckey[:], k.Mlseed[:]...)
+}
+
+// crypt encrypts or decrypts the secret key material of k with xorkey.
+func (k *hybridenckey) crypt(xorkey []byte) {
+	for i := 0; i < len(k.Seckey); i++ {
+		k.Seckey[i] ^= xorkey[i]
+	}
+	for i := 0; i < len(k.Mlseed); i++ {
+		k.Mlseed[i] ^= xorkey[len(k.Seckey)+i]
+	}
+}
+
+func generatehybrid(pubkeyfile, seckeyfile string, rounds int, comment string) error {
+	var (
+		pubkey hybridpubkey
+		enckey hybridenckey
+		xorkey [secretbytes + mldsaseedbytes]byte
+	)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+	util.MlockBytes(xorkey[:])
+	defer util.MunlockBytes(xorkey[:])
+	defer util.BzeroBytes(xorkey[:])
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	mlkey, err := mldsa.GenerateKey(mldsa.MLDSA65())
+	if err != nil {
+		return err
+	}
+	copy(pubkey.Pubkey[:], publicKey)
+	copy(pubkey.Mlpubkey[:], mlkey.PublicKey().Bytes())
+	copy(enckey.Seckey[:], privateKey)
+	copy(enckey.Mlseed[:], mlkey.Bytes())
+	util.BzeroBytes(privateKey) // wipe early, wipe often
+	if _, err := io.ReadFull(rand.Reader, enckey.Keynum[:]); err != nil {
+		return err
+	}
+	pubkey.Keynum = enckey.Keynum
+
+	secret := enckey.secret()
+	util.MlockBytes(secret)
+	defer util.MunlockBytes(secret)
+	defer util.BzeroBytes(secret)
+	digest := hash.SHA512(secret)
+	util.MlockBytes(digest)
+	defer util.MunlockBytes(digest)
+	defer util.BzeroBytes(digest)
+
+	copy(enckey.Pkalg[:], []byte(hybridalg))
+	copy(enckey.Kdfalg[:], []byte(kdfalg))
+	binary.BigEndian.PutUint32(enckey.Kdfrounds[:], uint32(rounds))
+	if _, err := io.ReadFull(rand.Reader, enckey.Salt[:]); err != nil {
+		return err
+	}
+	if err := kdf(enckey.Salt[:], rounds, true, xorkey[:]); err != nil {
+		return err
+	}
+	copy(enckey.Checksum[:], digest[:])
+	enckey.crypt(xorkey[:])
+	util.BzeroBytes(digest)    // wipe early, wipe often
+	util.BzeroBytes(xorkey[:]) // wipe early, wipe often
+
+	commentbuf := fmt.Sprintf("%s secret key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	if err := writeb64file(seckeyfile, commentbuf, &enckey, nil, os.O_EXCL, 0600); err != nil {
+		return err
+	}
+	util.BzeroStruct(&enckey) // wipe early, wipe often
+
+	copy(pubkey.Pkalg[:], []byte(hybridalg))
+	commentbuf = fmt.Sprintf("%s public key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	return writeb64file(pubkeyfile, commentbuf, &pubkey, nil, os.O_EXCL, 0666)
+}
+
+// ishybrid reports whether the key file keyfile contains a hybrid key. Keys
+// read from stdin are never hybrid keys.
+func ishybrid(keyfile string) bool {
+	if !regularfile(keyfile) {
+		return false
+	}
+	_, buf, err := readb64file(keyfile)
+	return err == nil && string(buf[:2]) == hybridalg
+}
+
+// readhybridseckey reads the hybrid secret key from seckeyfile into enckey
+// and decrypts it with a passphrase read from stdin. The caller is
+// responsible for locking and wiping enckey.
+func readhybridseckey(seckeyfile string, enckey *hybridenckey) (string, error) {
+	var xorkey [secretbytes + mldsaseedbytes]byte
+	util.MlockBytes(xorkey[:])
+	defer util.MunlockBytes(xorkey[:])
+	defer util.BzeroBytes(xorkey[:])
+
+	comment, buf, err := readb64file(seckeyfile)
+	if err != nil {
+		return "", err
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, enckey); err != nil {
+		return "", err
+	}
+	if string(enckey.Pkalg[:]) != hybridalg {
+		return "", fmt.Errorf("unsupported file %s", seckeyfile)
+	}
+	if string(enckey.Kdfalg[:]) != kdfalg {
+		return "", errors.New("unsupported KDF")
+	}
+	rounds := binary.BigEndian.Uint32(enckey.Kdfrounds[:])
+	if err := kdf(enckey.Salt[:], int(rounds), false, xorkey[:]); err != nil {
+		return "", err
+	}
+	enckey.crypt(xorkey[:])
+	util.BzeroBytes(xorkey[:]) // wipe early, wipe often
+	secret := enckey.secret()
+	util.MlockBytes(secret)
+	defer util.MunlockBytes(secret)
+	defer util.BzeroBytes(secret)
+	digest := hash.SHA512(secret)
+	util.MlockBytes(digest)
+	defer util.MunlockBytes(digest)
+	defer util.BzeroBytes(digest)
+	if !bytes.Equal(enckey.Checksum[:], digest[:8]) {
+		return "", errors.New("incorrect passphrase")
+	}
+	return comment, nil
+}
+
+// signhybrid signs msgfile with the hybrid secret key in seckeyfile.
+func signhybrid(seckeyfile, msgfile, sigfile string, embedded bool) error {
+	var (
+		enckey hybridenckey
+		sig    hybridsig
+	)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	comment, err := readhybridseckey(seckeyfile, &enckey)
+	if err != nil {
+		return err
+	}
+	msg, err := readmsg(msgfile)
+	if err != nil {
+		return err
+	}
+	mlkey, err := mldsa.NewPrivateKey(mldsa.MLDSA65(), enckey.Mlseed[:])
+	if err != nil {
+		return err
+	}
+	mlsig, err := mlkey.Sign(nil, msg, &mldsa.Options{Context: hybridcontext})
+	if err != nil {
+		return err
+	}
+	copy(sig.Pkalg[:], []byte(hybridalg))
+	sig.Keynum = enckey.Keynum
+	copy(sig.Sig[:], ed25519.Sign(enckey.Seckey[:], append(append([]byte{}, hybridhead...), msg...)))
+	copy(sig.Mlsig[:], mlsig)
+	util.BzeroStruct(&enckey) // wipe early, wipe often
+
+	sigcomment, err := makesigcomment(seckeyfile, comment)
+	if err != nil {
+		return err
+	}
+	if !embedded {
+		msg = nil
+	}
+	return writeb64file(sigfile, sigcomment, &sig, msg, os.O_TRUNC, 0666)
+}
+
+// verifyhybrid verifies the hybrid signature in buf of msg.
+func verifyhybrid(opts *verifyopts, sigcomment string, buf []byte, msg *message) error {
+	var (
+		sig hybridsig
+		key hybridpubkey
+	)
+	if len(buf) != binary.Size(&sig) {
+		return errors.New("invalid signature")
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &sig); err != nil {
+		return err
+	}
+	if len(opts.pubkeyfiles) > 1 || opts.threshold > 0 || len(opts.chain) > 0 {
+		return errors.New("hybrid signature requires a single public key")
+	}
+	// keyrings and allowed signers only hold Ed25519 keys
+	if opts.key != nil || (len(opts.pubkeyfiles) == 0 && opts.keyring != nil) {
+		return errors.New("hybrid signature requires a hybrid public key, keyrings are not supported")
+	}
+	if opts.namespace != "" {
+		return fmt.Errorf("signature not made in namespace %s", opts.namespace)
+	}
+	pkbuf, err := readpubkey(opts.pubkeyfile(), sigcomment, hybridalg)
+	if err != nil {
+		return err
+	}
+	if err := binary.Read(bytes.NewReader(pkbuf), binary.BigEndian, &key); err != nil ||
+		string(key.Pkalg[:]) != hybridalg {
+		return errors.New("hybrid signature requires a hybrid public key")
+	}
+	if err := opts.checkrevoked(sig.Keynum); err != nil {
+		return err
+	}
+	if sig.Keynum != key.Keynum {
+		return errors.New("verification failed: checked against wrong key")
+	}
+	edkey := &pubkey{Keynum: key.Keynum, Pubkey: key.Pubkey}
+	ok, err := msg.withhead(hybridhead).verify(edkey, sig.Sig[:])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("signature verification failed")
+	}
+	mlkey, err := mldsa.NewPublicKey(mldsa.MLDSA65(), key.Mlpubkey[:])
+	if err != nil {
+		return err
+	}
+	buf, err = msg.bytes()
+	if err != nil {
+		return err
+	}
+	if err := mldsa.Verify(mlkey, buf, sig.Mlsig[:], &mldsa.Options{Context: hybridcontext}); err != nil {
+		return errors.New("signature verification failed")
+	}
+	if !opts.quiet {
+		fmt.Println("Signature Verified")
+	}
+	return nil
+}
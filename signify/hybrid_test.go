@@ -0,0 +1,124 @@
+package signify
+
+import (
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+)
+
+func TestHybrid(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	edpubkeyfile := filepath.Join(tmpdir, "ed.pub")
+	edseckeyfile := filepath.Join(tmpdir, "ed.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	sigfile := msgfile + ".sig"
+	if err := Main("signify", "-G", "-n", "-hybrid", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", edpubkeyfile, "-s", edseckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-I", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-I", "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// Ed25519 keys cannot verify hybrid signatures
+	if err := Main("signify", "-V", "-q", "-p", edpubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// keyrings only hold Ed25519 keys
+	ring := filepath.Join(tmpdir, "keyring")
+	if err := Main("signify", "-K", "-k", ring, "add", edpubkeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-k", ring, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// tampered ML-DSA signature
+	comment, buf, err := readb64file(sigfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf[len(buf)-1] ^= 1
+	if err := writeb64file(sigfile, comment, buf, nil, os.O_TRUNC, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// signatures made with only the Ed25519 half are no hybrid signatures
+	var enckey hybridenckey
+	if _, err := readhybridseckey(seckeyfile, &enckey); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := ioutil.ReadFile(msgfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edsig sig
+	copy(edsig.Pkalg[:], []byte(pkalg))
+	edsig.Keynum = enckey.Keynum
+	copy(edsig.Sig[:], ed25519.Sign(enckey.Seckey[:], msg))
+	if err := writeb64file(sigfile, "signature", &edsig, nil, os.O_TRUNC, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-threshold", "1", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// embedded message
+	if err := Main("signify", "-S", "-e", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	confirmfile := filepath.Join(tmpdir, "confirm.txt")
+	if err := Main("signify", "-V", "-q", "-e", "-p", pubkeyfile, "-x", sigfile, "-m", confirmfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(msgfile, confirmfile); err != nil {
+		t.Error(err)
+	}
+
+	// signed checksum list
+	hsh := filepath.Join(tmpdir, "SHA256")
+	hp, err := os.Create(hsh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hash.SHA256Sum([]string{msgfile}, hp, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := hp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-e", "-s", seckeyfile, "-m", hsh); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-C", "-q", "-p", pubkeyfile, "-x", hsh+".sig"); err != nil {
+		t.Error(err)
+	}
+}
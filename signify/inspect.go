@@ -0,0 +1,111 @@
+package signify
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// algname returns the name of the signature algorithm of pkalg.
+func algname(alg string) string {
+	switch alg {
+	case pkalg:
+		return "Ed25519"
+	case phalg:
+		return "Ed25519ph"
+	case hybridalg:
+		return "Ed25519+ML-DSA-65"
+	}
+	return alg
+}
+
+// keyinfo describes the key in buf. For secret keys, the KDF protecting them
+// is shown as well.
+func keyinfo(buf []byte, secret bool) (string, error) {
+	alg := string(buf[:2])
+	if alg != pkalg && alg != hybridalg {
+		return "", errors.New("unsupported key")
+	}
+	if !secret {
+		if len(buf) < 2+keynumlen {
+			return "", errors.New("invalid key")
+		}
+		return fmt.Sprintf("%s public key %s", algname(alg),
+			hex.EncodeToString(buf[2:2+keynumlen])), nil
+	}
+	keynum, err := enckeynum(buf)
+	if err != nil {
+		return "", err
+	}
+	kdf := "bcrypt_pbkdf"
+	switch string(buf[2:4]) {
+	case argonalg:
+		kdf = "Argon2id"
+	case keyfilealg:
+		kdf = "Argon2id, passphrase and keyfile"
+	case recipientalg:
+		_, stanzas, _ := parserecipientkey(buf)
+		kdf = fmt.Sprintf("%d X25519 recipients", len(stanzas))
+	}
+	return fmt.Sprintf("%s secret key %s (%s)", algname(alg),
+		hex.EncodeToString(keynum[:]), kdf), nil
+}
+
+// siginfo describes the signature in buf.
+func siginfo(buf []byte) (string, error) {
+	switch string(buf[:2]) {
+	case hybridalg:
+		if len(buf) < 2+keynumlen {
+			return "", errors.New("invalid signature")
+		}
+		return fmt.Sprintf("%s signature %s", algname(hybridalg),
+			hex.EncodeToString(buf[2:2+keynumlen])), nil
+	case multisigalg:
+		sigs, err := parsesigs(buf)
+		if err != nil {
+			return "", err
+		}
+		info := fmt.Sprintf("%s multi-signature", algname(pkalg))
+		for _, s := range sigs {
+			info += " " + hex.EncodeToString(s.Keynum[:])
+		}
+		return info, nil
+	}
+	keynum, err := sigkeynum(buf)
+	if err != nil {
+		return "", err
+	}
+	alg := pkalg
+	if string(buf[:2]) == phalg {
+		alg = phalg
+	}
+	return fmt.Sprintf("%s signature %s", algname(alg), hex.EncodeToString(keynum[:])), nil
+}
+
+// inspect prints the algorithm and key number of the given public key,
+// secret key, and signature files. Secret keys are not decrypted.
+func inspect(pubkeyfile, seckeyfile, sigfile string) error {
+	files := []struct {
+		name string
+		info func([]byte) (string, error)
+	}{
+		{pubkeyfile, func(buf []byte) (string, error) { return keyinfo(buf, false) }},
+		{seckeyfile, func(buf []byte) (string, error) { return keyinfo(buf, true) }},
+		{sigfile, siginfo},
+	}
+	for _, f := range files {
+		if f.name == "" {
+			continue
+		}
+		_, buf, err := readb64file(f.name)
+		if err != nil {
+			return err
+		}
+		info, err := f.info(buf)
+		if err != nil {
+			return fmt.Errorf("%s: %s", f.name, err)
+		}
+		fmt.Printf("%s: %s\n", f.name, info)
+	}
+	return nil
+}
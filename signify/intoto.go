@@ -0,0 +1,60 @@
+package signify
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+)
+
+const (
+	intotoStatementType = "https://in-toto.io/Statement/v1"
+	intotoPayloadType   = "application/vnd.in-toto+json"
+)
+
+type intotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type intotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []intotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+// statement writes an in-toto statement with the given predicateType about
+// the given files to msgfile. The predicate is read from predicatefile, if
+// given, and is empty otherwise.
+func statement(msgfile, predicateType, predicatefile string, files []string) error {
+	if len(files) == 0 {
+		return errors.New("no files given")
+	}
+	st := intotoStatement{
+		Type:          intotoStatementType,
+		PredicateType: predicateType,
+		Predicate:     json.RawMessage("{}"),
+	}
+	if predicatefile != "" {
+		predicate, err := readmsg(predicatefile)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(predicate) {
+			return errors.New("predicate is not valid JSON")
+		}
+		st.Predicate = json.RawMessage(predicate)
+	}
+	for _, file := range files {
+		digest, err := hash.SHA256File(file)
+		if err != nil {
+			return err
+		}
+		st.Subject = append(st.Subject, intotoSubject{
+			Name:   file,
+			Digest: map[string]string{"sha256": digest},
+		})
+	}
+	return writejson(msgfile, &st)
+}
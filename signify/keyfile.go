@@ -0,0 +1,87 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+const (
+	keyfilealg        = "AK" // version 2 secret key unlocked with passphrase and keyfile
+	keyfileenv        = "GOSIGNIFY_KEYFILE"
+	keyfilebytes      = 32 // size of created keyfiles
+	keyfilecheckbytes = 8
+	keyfilecontext    = "gosignify keyfile v1"
+)
+
+// readkeyfile returns the SHA-512 hash of the contents of the keyfile
+// filename. If create is true and the keyfile does not exist, a random
+// keyfile is created. The hash is locked to memory and must be wiped and
+// unlocked by the caller.
+func readkeyfile(filename string, create bool) ([]byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) && create {
+		data = make([]byte, keyfilebytes)
+		if _, err := io.ReadFull(rand.Reader, data); err != nil {
+			return nil, err
+		}
+		var fd *os.File
+		fd, err = xopen(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		_, err = fd.Write(data)
+		if e := fd.Close(); err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	util.MlockBytes(data)
+	defer util.MunlockBytes(data)
+	defer util.BzeroBytes(data)
+	if len(data) == 0 {
+		return nil, fmt.Errorf("keyfile %s is empty", filename)
+	}
+	digest := hash.SHA512(data)
+	util.MlockBytes(digest)
+	return digest, nil
+}
+
+// keyfilecheck returns the check value of the keyfile hash digest for salt,
+// which tells a wrong keyfile from a wrong passphrase.
+func keyfilecheck(salt, digest []byte) []byte {
+	buf := append(append([]byte(keyfilecontext+"\x00"), salt...), digest...)
+	defer util.BzeroBytes(buf)
+	return hash.SHA512(buf)[:keyfilecheckbytes]
+}
+
+// unlockkeyfile reads the keyfile given with -keyfile, or named by
+// $GOSIGNIFY_KEYFILE, and checks it against check. The returned hash must be
+// wiped and unlocked by the caller.
+func unlockkeyfile(salt, check []byte) ([]byte, error) {
+	filename := unlockwith
+	if filename == "" {
+		filename = os.Getenv(keyfileenv)
+	}
+	if filename == "" {
+		return nil, fmt.Errorf("secret key requires a keyfile, use -keyfile or set $%s", keyfileenv)
+	}
+	digest, err := readkeyfile(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(keyfilecheck(salt, digest), check) {
+		util.BzeroBytes(digest)
+		util.MunlockBytes(digest)
+		return nil, fmt.Errorf("incorrect keyfile %s", filename)
+	}
+	return digest, nil
+}
@@ -0,0 +1,106 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyfile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	defer os.Unsetenv(keyfileenv)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	keyfile := filepath.Join(tmpdir, "keyfile")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\ntopsecret\n")
+	if err := Main("signify", "-G", "-keyfile", keyfile, "-kdfmemory", "1", "-kdftime", "1",
+		"-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(keyfile); err != nil || fi.Size() != keyfilebytes {
+		t.Fatalf("keyfile not created: %v", err)
+	}
+	// missing keyfile
+	setstdin(t, tmpdir, "topsecret\n")
+	err = Main("signify", "-S", "-s", seckeyfile, "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), keyfileenv) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// wrong keyfile
+	os.Setenv(keyfileenv, msgfile)
+	setstdin(t, tmpdir, "topsecret\n")
+	err = Main("signify", "-S", "-s", seckeyfile, "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "incorrect keyfile") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// wrong passphrase
+	os.Setenv(keyfileenv, keyfile)
+	setstdin(t, tmpdir, "wrong\n")
+	err = Main("signify", "-S", "-s", seckeyfile, "-m", msgfile)
+	if err == nil || err.Error() != "incorrect passphrase" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	setstdin(t, tmpdir, "topsecret\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// re-encrypt with another keyfile
+	otherkeyfile := filepath.Join(tmpdir, "photo.jpg")
+	if err := ioutil.WriteFile(otherkeyfile, []byte("not really a photo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "topsecret\nnewsecret\nnewsecret\n")
+	if err := Main("signify", "-migrate", "-keyfile", otherkeyfile, "-kdfmemory", "1", "-kdftime", "1",
+		"-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "newsecret\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	os.Setenv(keyfileenv, otherkeyfile)
+	setstdin(t, tmpdir, "newsecret\n")
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// -keyfile takes precedence over the environment
+	os.Unsetenv(keyfileenv)
+	setstdin(t, tmpdir, "newsecret\n")
+	if err := Main("signify", "-S", "-keyfile", otherkeyfile, "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(keyfileenv, keyfile)
+	setstdin(t, tmpdir, "newsecret\n")
+	if err := Main("signify", "-revoke", "-keyfile", otherkeyfile, "-s", seckeyfile,
+		"-p", pubkeyfile, "-x", filepath.Join(tmpdir, "revoked.list")); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "newsecret\n")
+	err = Main("signify", "-S", "-s", seckeyfile, "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "incorrect keyfile") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Main("signify", "-V", "-keyfile", keyfile, "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-G", "-n", "-keyfile", keyfile,
+		"-p", filepath.Join(tmpdir, "n.pub"), "-s", filepath.Join(tmpdir, "n.sec")); err == nil {
+		t.Error("should fail")
+	}
+}
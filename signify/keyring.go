@@ -0,0 +1,287 @@
+package signify
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const keyringenv = "GOSIGNIFY_KEYRING"
+
+// keyring is a collection of public keys indexed by key number. It is either
+// a directory containing a public key file named keynum.pub for every key,
+// or a single file containing the public key files one after another.
+type keyring struct {
+	path string
+	dir  bool
+}
+
+// ringkey is a public key in a keyring together with its comment.
+type ringkey struct {
+	file    string // file of the key in a keyring directory
+	comment string
+	key     pubkey
+}
+
+func openkeyring(path string) (*keyring, error) {
+	fi, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &keyring{path: path, dir: err == nil && fi.IsDir()}, nil
+}
+
+func parsekeynum(s string) ([keynumlen]byte, error) {
+	var keynum [keynumlen]byte
+	buf, err := hex.DecodeString(s)
+	if err != nil || len(buf) != keynumlen {
+		return keynum, fmt.Errorf("invalid key number %s", s)
+	}
+	copy(keynum[:], buf)
+	return keynum, nil
+}
+
+func parseringkey(filename string, b64 []byte) (*ringkey, error) {
+	comment, buf, _, err := parseb64file(filename, b64)
+	if err != nil {
+		return nil, err
+	}
+	k := &ringkey{comment: comment}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &k.key); err != nil {
+		return nil, err
+	}
+	if string(k.key.Pkalg[:]) != pkalg {
+		return nil, fmt.Errorf("unsupported file %s", filename)
+	}
+	return k, nil
+}
+
+// keys returns all keys in the keyring, sorted by key number.
+func (r *keyring) keys() ([]ringkey, error) {
+	var keys []ringkey
+	if r.dir {
+		files, err := filepath.Glob(filepath.Join(r.path, "*.pub"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			b64, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			k, err := parseringkey(file, b64)
+			if err != nil {
+				return nil, err
+			}
+			k.file = file
+			keys = append(keys, *k)
+		}
+	} else {
+		b64, err := ioutil.ReadFile(r.path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		lines := strings.SplitAfter(string(b64), "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines)%2 != 0 {
+			return nil, fmt.Errorf("invalid keyring %s", r.path)
+		}
+		for i := 0; i < len(lines); i += 2 {
+			k, err := parseringkey(r.path, []byte(lines[i]+lines[i+1]))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, *k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i].key.Keynum[:], keys[j].key.Keynum[:]) < 0
+	})
+	return keys, nil
+}
+
+func (r *keyring) keyfile(keynum [keynumlen]byte) string {
+	return filepath.Join(r.path, hex.EncodeToString(keynum[:])+".pub")
+}
+
+// lookup returns the key with the key number keynum.
+func (r *keyring) lookup(keynum [keynumlen]byte) (*pubkey, error) {
+	if r.dir {
+		var key pubkey
+		file := r.keyfile(keynum)
+		if _, err := os.Stat(file); err == nil {
+			if err := readpubkeyfile(file, &key); err != nil {
+				return nil, err
+			}
+			return &key, nil
+		}
+	}
+	keys, err := r.keys()
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].key.Keynum == keynum {
+			return &keys[i].key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s not in keyring %s", hex.EncodeToString(keynum[:]), r.path)
+}
+
+// write replaces the keyring file with keys.
+func (r *keyring) write(keys []ringkey) error {
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s%s\n", commenthdr, k.comment)
+		var key bytes.Buffer
+		binary.Write(&key, binary.BigEndian, &k.key)
+		fmt.Fprintf(&buf, "%s\n", base64.StdEncoding.EncodeToString(key.Bytes()))
+	}
+	tmpfile := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmpfile, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpfile, r.path)
+}
+
+// add adds the keys in pubkeyfiles to the keyring.
+func (r *keyring) add(pubkeyfiles []string) error {
+	keys, err := r.keys()
+	if err != nil {
+		return err
+	}
+	for _, pubkeyfile := range pubkeyfiles {
+		b64, err := ioutil.ReadFile(pubkeyfile)
+		if err != nil {
+			return err
+		}
+		k, err := parseringkey(pubkeyfile, b64)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if key.key.Keynum == k.key.Keynum {
+				return fmt.Errorf("key %s already in keyring",
+					hex.EncodeToString(k.key.Keynum[:]))
+			}
+		}
+		if r.dir {
+			err := writeb64file(r.keyfile(k.key.Keynum), k.comment, &k.key, nil, os.O_EXCL, 0666)
+			if err != nil {
+				return err
+			}
+		}
+		keys = append(keys, *k)
+	}
+	if r.dir {
+		return nil
+	}
+	return r.write(keys)
+}
+
+// remove removes the keys with the given key numbers from the keyring.
+func (r *keyring) remove(keynums []string) error {
+	keys, err := r.keys()
+	if err != nil {
+		return err
+	}
+	for _, s := range keynums {
+		keynum, err := parsekeynum(s)
+		if err != nil {
+			return err
+		}
+		found := false
+		for i := range keys {
+			if keys[i].key.Keynum != keynum {
+				continue
+			}
+			if r.dir {
+				if err := os.Remove(keys[i].file); err != nil {
+					return err
+				}
+			}
+			keys = append(keys[:i], keys[i+1:]...)
+			found = true
+			break
+		}
+		if !found {
+			return fmt.Errorf("key %s not in keyring %s", s, r.path)
+		}
+	}
+	if r.dir {
+		return nil
+	}
+	return r.write(keys)
+}
+
+// list shows the key numbers and comments of all keys in the keyring.
+func (r *keyring) list() error {
+	keys, err := r.keys()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		fmt.Printf("%s %s\n", hex.EncodeToString(k.key.Keynum[:]), k.comment)
+	}
+	return nil
+}
+
+// export writes the key with the given key number to pubkeyfile.
+func (r *keyring) export(keynum, pubkeyfile string) error {
+	kn, err := parsekeynum(keynum)
+	if err != nil {
+		return err
+	}
+	keys, err := r.keys()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if k.key.Keynum == kn {
+			return writeb64file(pubkeyfile, k.comment, &k.key, nil, os.O_EXCL, 0666)
+		}
+	}
+	return fmt.Errorf("key %s not in keyring %s", keynum, r.path)
+}
+
+// keyringcmd runs the keyring command given in args.
+func keyringcmd(r *keyring, pubkeyfile string, args []string) error {
+	if len(args) == 0 {
+		usage()
+		return errors.New("must specify keyring command")
+	}
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "add":
+		if len(args) == 0 {
+			return errors.New("must specify public keys to add")
+		}
+		return r.add(args)
+	case "list":
+		return r.list()
+	case "remove":
+		if len(args) == 0 {
+			return errors.New("must specify key numbers to remove")
+		}
+		return r.remove(args)
+	case "export":
+		if len(args) != 1 || pubkeyfile == "" {
+			return errors.New("must specify key number and pubkey")
+		}
+		return r.export(args[0], pubkeyfile)
+	default:
+		usage()
+		return fmt.Errorf("unknown keyring command %s", cmd)
+	}
+}
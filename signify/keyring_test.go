@@ -0,0 +1,128 @@
+package signify
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKeyring(t *testing.T, tmpdir, ring string) {
+	var keynums []string
+	for _, name := range []string{"alice", "bob"} {
+		pubkeyfile := filepath.Join(tmpdir, name+".pub")
+		seckeyfile := filepath.Join(tmpdir, name+".sec")
+		if _, err := os.Stat(pubkeyfile); os.IsNotExist(err) {
+			if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var pk pubkey
+		if err := readpubkeyfile(pubkeyfile, &pk); err != nil {
+			t.Fatal(err)
+		}
+		keynums = append(keynums, hex.EncodeToString(pk.Keynum[:]))
+	}
+	alicepub := filepath.Join(tmpdir, "alice.pub")
+	bobpub := filepath.Join(tmpdir, "bob.pub")
+	if err := Main("signify", "-K", "-k", ring, "add", alicepub, bobpub); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-K", "-k", ring, "add", alicepub); err == nil {
+		t.Error("should fail")
+	}
+	r, err := openkeyring(ring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := r.keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("keyring contains %d keys", len(keys))
+	}
+
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		seckeyfile := filepath.Join(tmpdir, name+".sec")
+		sigfile := filepath.Join(tmpdir, name+".sig")
+		if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile, "-x", sigfile); err != nil {
+			t.Fatal(err)
+		}
+		if err := Main("signify", "-V", "-q", "-k", ring, "-m", msgfile, "-x", sigfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// bob must not be able to revoke alice
+	forged := filepath.Join(tmpdir, "forged.list")
+	if err := Main("signify", "-revoke", "-s", filepath.Join(tmpdir, "bob.sec"), "-p", alicepub, "-x", forged); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", forged, "-k", ring, "-m", msgfile,
+		"-x", filepath.Join(tmpdir, "alice.sig")); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", forged, "-revoker", alicepub, "-k", ring, "-m", msgfile,
+		"-x", filepath.Join(tmpdir, "alice.sig")); err == nil {
+		t.Error("should fail")
+	}
+	// export
+	exported := filepath.Join(tmpdir, "exported.pub")
+	if err := Main("signify", "-K", "-k", ring, "-p", exported, "export", keynums[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(alicepub, exported); err != nil {
+		t.Error(err)
+	}
+	if err := os.Remove(exported); err != nil {
+		t.Fatal(err)
+	}
+	// remove
+	if err := Main("signify", "-K", "-k", ring, "remove", keynums[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-K", "-k", ring, "remove", keynums[1]); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-k", ring, "-m", msgfile,
+		"-x", filepath.Join(tmpdir, "bob.sig")); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-k", ring, "-m", msgfile,
+		"-x", filepath.Join(tmpdir, "alice.sig")); err != nil {
+		t.Error(err)
+	}
+	if err := Main("signify", "-K", "-k", ring, "remove", keynums[0]); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err := r.keys(); err != nil || len(keys) != 0 {
+		t.Errorf("keyring not empty: %v", err)
+	}
+}
+
+func TestKeyringFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	testKeyring(t, tmpdir, filepath.Join(tmpdir, "keyring"))
+}
+
+func TestKeyringDir(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	ring := filepath.Join(tmpdir, "keyring")
+	if err := os.Mkdir(ring, 0755); err != nil {
+		t.Fatal(err)
+	}
+	testKeyring(t, tmpdir, ring)
+}
@@ -0,0 +1,121 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/bip39"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+const mnemonicwords = 6 // per line
+
+// exportmnemonic writes the seed and key number of the secret key seckeyfile
+// as mnemonic to outfile, which must not exist unless it is stdout.
+func exportmnemonic(seckeyfile, outfile string) error {
+	var enckey enckey
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	if _, err := readseckey(seckeyfile, &enckey); err != nil {
+		return err
+	}
+	data := make([]byte, seedbytes+keynumlen)
+	util.MlockBytes(data)
+	defer util.MunlockBytes(data)
+	defer util.BzeroBytes(data)
+	copy(data, enckey.Seckey[:seedbytes])
+	copy(data[seedbytes:], enckey.Keynum[:])
+	mnemonic, err := bip39.Encode(data)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for i, w := range strings.Fields(mnemonic) {
+		if i > 0 && i%mnemonicwords == 0 {
+			buf.WriteByte('\n')
+		} else if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(w)
+	}
+	buf.WriteByte('\n')
+	defer util.BzeroBytes(buf.Bytes())
+	fd, err := xopen(outfile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(buf.Bytes()); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// readmnemonic reads a mnemonic from infile, or a single line from stdin if
+// infile is empty.
+func readmnemonic(infile string) ([]byte, error) {
+	if infile != "" {
+		return ioutil.ReadFile(infile)
+	}
+	fmt.Printf("mnemonic: ")
+	line, err := readline(os.Stdin)
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, errors.New("unable to read mnemonic")
+	}
+	return line, nil
+}
+
+// restoremnemonic restores the secret key seckeyfile, protected as described
+// by opts, from the mnemonic in infile (or stdin) after verifying it against
+// the public key pubkeyfile.
+func restoremnemonic(pubkeyfile, seckeyfile, infile, comment string, rounds int, opts *protectopts) error {
+	var (
+		pub    pubkey
+		enckey enckey
+	)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	if err := readpubkeyfile(pubkeyfile, &pub); err != nil {
+		return err
+	}
+	mnemonic, err := readmnemonic(infile)
+	if err != nil {
+		return err
+	}
+	data, err := bip39.Decode(string(mnemonic))
+	util.BzeroBytes(mnemonic) // wipe early, wipe often
+	if err != nil {
+		return err
+	}
+	util.MlockBytes(data)
+	defer util.MunlockBytes(data)
+	defer util.BzeroBytes(data)
+	if len(data) != seedbytes+keynumlen {
+		return errors.New("invalid mnemonic")
+	}
+	privateKey := ed25519.NewKeyFromSeed(data[:seedbytes])
+	copy(enckey.Seckey[:], privateKey)
+	util.BzeroBytes(privateKey) // wipe early, wipe often
+	copy(enckey.Keynum[:], data[seedbytes:])
+	if enckey.Keynum != pub.Keynum || !bytes.Equal(enckey.Seckey[publicbytes:], pub.Pubkey[:]) {
+		return fmt.Errorf("mnemonic does not match %s", pubkeyfile)
+	}
+	commentbuf := fmt.Sprintf("%s secret key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	return writeseckey(seckeyfile, commentbuf, &enckey, rounds, opts)
+}
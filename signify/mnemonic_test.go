@@ -0,0 +1,85 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMnemonic(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	otherpub := filepath.Join(tmpdir, "other.pub")
+	wordfile := filepath.Join(tmpdir, "words.txt")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", otherpub, "-s", filepath.Join(tmpdir, "other.sec")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-mnemonic", "-s", seckeyfile, "-x", wordfile); err != nil {
+		t.Fatal(err)
+	}
+	words, err := ioutil.ReadFile(wordfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(strings.Fields(string(words))); n != 30 {
+		t.Fatalf("%d words", n)
+	}
+
+	// restore from a file and sign with the restored key
+	restored := filepath.Join(tmpdir, "restored.sec")
+	if err := Main("signify", "-restore", "-n", "-m", wordfile, "-p", pubkeyfile, "-s", restored); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", restored, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// restore from stdin with a new passphrase
+	line := strings.Join(strings.Fields(string(words)), " ")
+	setstdin(t, tmpdir, line+"\nnewsecret\nnewsecret\n")
+	protected := filepath.Join(tmpdir, "protected.sec")
+	if err := Main("signify", "-restore", "-p", pubkeyfile, "-s", protected); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "newsecret\n")
+	if err := Main("signify", "-S", "-s", protected, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// the wrong public key and a wrong word
+	if err := Main("signify", "-restore", "-n", "-m", wordfile, "-p", otherpub, "-s", filepath.Join(tmpdir, "x.sec")); err == nil {
+		t.Error("should fail")
+	}
+	fields := strings.Fields(line)
+	if fields[0] == "zoo" {
+		fields[0] = "abandon"
+	} else {
+		fields[0] = "zoo"
+	}
+	setstdin(t, tmpdir, strings.Join(fields, " ")+"\n")
+	if err := Main("signify", "-restore", "-n", "-p", pubkeyfile, "-s", filepath.Join(tmpdir, "x.sec")); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "x.sec")); !os.IsNotExist(err) {
+		t.Error("secret key should not exist")
+	}
+}
@@ -0,0 +1,176 @@
+package signify
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// multisigalg marks a multi-signature: a list of signatures (each with its own
+// pkalg and keynum) of the same message.
+const multisigalg = "MS"
+
+// parsesigs parses buf, which contains either a single signature or a
+// multi-signature, and returns the signatures.
+func parsesigs(buf []byte) ([]sig, error) {
+	var s sig
+	size := binary.Size(&s)
+	if len(buf) >= 2 && string(buf[:2]) == multisigalg {
+		buf = buf[2:]
+		if len(buf) == 0 || len(buf)%size != 0 {
+			return nil, errors.New("invalid multi-signature")
+		}
+	} else if len(buf) != size {
+		return nil, errors.New("invalid signature")
+	}
+	sigs := make([]sig, len(buf)/size)
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, sigs); err != nil {
+		return nil, err
+	}
+	for _, s := range sigs {
+		if string(s.Pkalg[:]) != pkalg {
+			return nil, errors.New("unsupported signature algorithm")
+		}
+	}
+	return sigs, nil
+}
+
+// marshalsigs returns the multi-signature for sigs.
+func marshalsigs(sigs []sig) ([]byte, error) {
+	buf := bytes.NewBufferString(multisigalg)
+	if err := binary.Write(buf, binary.BigEndian, sigs); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// verifymulti verifies that at least opts.threshold of the public keys in
+// opts.pubkeyfiles made a valid signature of msg in sigs. Every key which
+// signed is reported, unless opts.quiet is set.
+func verifymulti(opts *verifyopts, msg *message, sigs []sig) error {
+	if len(opts.pubkeyfiles) == 0 {
+		return errors.New("multi-signature requires public keys")
+	}
+	threshold := opts.threshold
+	if threshold == 0 {
+		threshold = len(opts.pubkeyfiles)
+	}
+	if threshold < 0 || threshold > len(opts.pubkeyfiles) {
+		return fmt.Errorf("threshold %d not in range 1..%d", threshold, len(opts.pubkeyfiles))
+	}
+	signed := 0
+	seen := make(map[[keynumlen]byte]bool)
+	for _, pubkeyfile := range opts.pubkeyfiles {
+		var pubkey pubkey
+		if err := readpubkeyfile(pubkeyfile, &pubkey); err != nil {
+			return err
+		}
+		if seen[pubkey.Keynum] {
+			return fmt.Errorf("duplicate public key %s", pubkeyfile)
+		}
+		seen[pubkey.Keynum] = true
+		if err := opts.checkrevoked(pubkey.Keynum); err != nil {
+			if !opts.quiet {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", pubkeyfile, err)
+			}
+			continue
+		}
+		for _, s := range sigs {
+			if s.Keynum != pubkey.Keynum {
+				continue
+			}
+			ok, err := msg.verify(&pubkey, s.Sig[:])
+			if err != nil {
+				return err
+			}
+			if ok {
+				signed++
+				if !opts.quiet {
+					fmt.Printf("Signature from %s verified\n", pubkeyfile)
+				}
+			}
+			break
+		}
+	}
+	if signed < threshold {
+		return fmt.Errorf("signature verification failed: %d of %d required signatures", signed, threshold)
+	}
+	if !opts.quiet {
+		fmt.Println("Signature Verified")
+	}
+	return nil
+}
+
+// cosign adds a signature made with seckeyfile to the existing signature file
+// sigfile, turning it into a multi-signature if necessary. If embedded is
+// true, the message embedded in sigfile is signed. Otherwise, msgfile is
+// signed. At least one of the existing signatures must be a valid signature of
+// the message by one of the public keys in pubkeyfiles.
+func cosign(seckeyfile, msgfile, sigfile string, embedded bool, pubkeyfiles []string) error {
+	var (
+		s      sig
+		embmsg []byte
+	)
+
+	data, err := readmsg(sigfile)
+	if err != nil {
+		return err
+	}
+	comment, buf, embmsg, err := parseb64file(sigfile, data)
+	if err != nil {
+		return err
+	}
+	sigs, err := parsesigs(buf)
+	if err != nil {
+		return err
+	}
+	msg := embmsg
+	if embedded {
+		if len(embmsg) == 0 {
+			return fmt.Errorf("%s contains no embedded message", sigfile)
+		}
+	} else {
+		if len(embmsg) > 0 {
+			return fmt.Errorf("%s contains an embedded message, use -e", sigfile)
+		}
+		msg, err = readmsg(msgfile)
+		if err != nil {
+			return err
+		}
+	}
+	opts := &verifyopts{
+		pubkeyfiles: pubkeyfiles,
+		threshold:   1,
+		quiet:       true,
+	}
+	if err := verifymulti(opts, &message{buf: msg}, sigs); err != nil {
+		return err
+	}
+
+	signer, err := newsigner(seckeyfile)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	s.Keynum = signer.Keynum()
+	for _, other := range sigs {
+		if other.Keynum == s.Keynum {
+			return errors.New("signature file already contains a signature of this key")
+		}
+	}
+	sig, err := signer.Sign(msg)
+	if err != nil {
+		return err
+	}
+	signer.Close() // wipe early, wipe often
+	copy(s.Pkalg[:], []byte(pkalg))
+	copy(s.Sig[:], sig)
+
+	buf, err = marshalsigs(append(sigs, s))
+	if err != nil {
+		return err
+	}
+	return writeb64file(sigfile, comment, buf, embmsg, os.O_TRUNC, 0666)
+}
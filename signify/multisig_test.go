@@ -0,0 +1,189 @@
+package signify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/frankbraun/gosignify/internal/hash"
+)
+
+func TestMultisig(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	var pubkeys, seckeys []string
+	for i := 0; i < 3; i++ {
+		pubkey := filepath.Join(tmpdir, fmt.Sprintf("key%d.pub", i))
+		seckey := filepath.Join(tmpdir, fmt.Sprintf("key%d.sec", i))
+		if err := Main("signify", "-G", "-n", "-p", pubkey, "-s", seckey); err != nil {
+			t.Fatal(err)
+		}
+		pubkeys = append(pubkeys, pubkey)
+		seckeys = append(seckeys, seckey)
+	}
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	otherfile := filepath.Join(tmpdir, "other.txt")
+	sigfile := msgfile + ".sig"
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(otherfile); err != nil {
+		t.Fatal(err)
+	}
+	all := []string{"-p", pubkeys[0], "-p", pubkeys[1], "-p", pubkeys[2]}
+	verify := func(extra ...string) error {
+		args := append([]string{"signify", "-V", "-q"}, extra...)
+		return Main(append(args, "-m", msgfile)...)
+	}
+
+	// sign with two of three keys
+	if err := Main("signify", "-S", "-s", seckeys[0], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-cosign", "-p", pubkeys[0], "-s", seckeys[1], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(append(all, "-threshold", "2")...); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify("-p", pubkeys[1]); err != nil {
+		t.Fatal(err)
+	}
+	// not enough signatures
+	if err := verify(append(all, "-threshold", "3")...); err == nil {
+		t.Error("should fail")
+	}
+	if err := verify(all...); err == nil {
+		t.Error("should fail")
+	}
+	if err := verify("-p", pubkeys[2]); err == nil {
+		t.Error("should fail")
+	}
+	// threshold larger than number of keys
+	if err := verify("-p", pubkeys[0], "-threshold", "2"); err == nil {
+		t.Error("should fail")
+	}
+	// signature file given as public key
+	if err := verify("-p", sigfile, "-p", pubkeys[0], "-threshold", "1"); err == nil {
+		t.Error("should fail")
+	}
+	// same key given twice
+	if err := verify("-p", pubkeys[0], "-p", pubkeys[0], "-threshold", "2"); err == nil {
+		t.Error("should fail")
+	}
+	// wrong message
+	if err := Main("signify", "-V", "-q", "-threshold", "1", "-p", pubkeys[0],
+		"-m", otherfile, "-x", sigfile); err == nil {
+		t.Error("should fail")
+	}
+	// existing signatures must be of the same message by a given key
+	if err := Main("signify", "-cosign", "-e", "-p", pubkeys[0], "-s", seckeys[2], "-x", sigfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-cosign", "-p", pubkeys[0], "-s", seckeys[2],
+		"-m", otherfile, "-x", sigfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-cosign", "-p", pubkeys[2], "-s", seckeys[2], "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// cannot sign twice with the same key
+	if err := Main("signify", "-cosign", "-p", pubkeys[1], "-s", seckeys[0], "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// third signature
+	if err := Main("signify", "-cosign", "-p", pubkeys[0], "-s", seckeys[2], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(all...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultisigEmbedded(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pub1 := filepath.Join(tmpdir, "key1.pub")
+	sec1 := filepath.Join(tmpdir, "key1.sec")
+	pub2 := filepath.Join(tmpdir, "key2.pub")
+	sec2 := filepath.Join(tmpdir, "key2.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	extracted := filepath.Join(tmpdir, "extracted.txt")
+	sigfile := msgfile + ".sig"
+	for _, k := range [][2]string{{pub1, sec1}, {pub2, sec2}} {
+		if err := Main("signify", "-G", "-n", "-p", k[0], "-s", k[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-e", "-s", sec1, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// embedded message must be signed with -e
+	if err := Main("signify", "-cosign", "-p", pub1, "-s", sec2, "-m", msgfile, "-x", sigfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-cosign", "-e", "-p", pub1, "-s", sec2, "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-e", "-q", "-p", pub1, "-p", pub2,
+		"-x", sigfile, "-m", extracted); err != nil {
+		t.Fatal(err)
+	}
+	if err := diff(msgfile, extracted); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMultisigCheck(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pub1 := filepath.Join(tmpdir, "key1.pub")
+	sec1 := filepath.Join(tmpdir, "key1.sec")
+	pub2 := filepath.Join(tmpdir, "key2.pub")
+	sec2 := filepath.Join(tmpdir, "key2.sec")
+	for _, k := range [][2]string{{pub1, sec1}, {pub2, sec2}} {
+		if err := Main("signify", "-G", "-n", "-p", k[0], "-s", k[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(tmpdir, "file.txt")
+	if err := createMsgfile(file); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := hash.SHA256File(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums := filepath.Join(tmpdir, "SHA256")
+	line := fmt.Sprintf("SHA256 (%s) = %s\n", file, digest)
+	if err := ioutil.WriteFile(sums, []byte(line), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sigfile := sums + ".sig"
+	if err := Main("signify", "-S", "-e", "-s", sec1, "-m", sums); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-cosign", "-e", "-p", pub1, "-s", sec2, "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-C", "-q", "-p", pub1, "-p", pub2, "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-C", "-q", "-p", pub1, "-x", sigfile); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,131 @@
+package signify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// phalg marks Ed25519ph (RFC 8032) signatures of the SHA-512 hash of the
+// message. It differs from pkalg, so verifiers which do not know it reject
+// such signatures.
+const phalg = "EP"
+
+// prehashsigner is implemented by signers which can create Ed25519ph
+// signatures.
+type prehashsigner interface {
+	// SignPrehashed signs the SHA-512 digest of a message with Ed25519ph.
+	SignPrehashed(digest []byte) ([]byte, error)
+}
+
+func (s *filesigner) SignPrehashed(digest []byte) ([]byte, error) {
+	key := ed25519.PrivateKey(s.enckey.Seckey[:])
+	return key.Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512})
+}
+
+// hashfile returns the SHA-512 hash of filename without reading it into
+// memory.
+func hashfile(filename string) ([]byte, error) {
+	fd, err := xopen(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h := sha512.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// signph creates an Ed25519ph signature of msgfile with seckeyfile.
+func signph(seckeyfile, msgfile, sigfile string) error {
+	signer, err := newsigner(seckeyfile)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	ph, ok := signer.(prehashsigner)
+	if !ok {
+		return fmt.Errorf("%s cannot create prehashed signatures", seckeyfile)
+	}
+
+	digest, err := hashfile(msgfile)
+	if err != nil {
+		return err
+	}
+	s, err := ph.SignPrehashed(digest)
+	if err != nil {
+		return err
+	}
+	var sig sig
+	copy(sig.Pkalg[:], []byte(phalg))
+	copy(sig.Sig[:], s)
+	sig.Keynum = signer.Keynum()
+	comment := signer.Comment()
+	signer.Close() // wipe early, wipe often
+
+	sigcomment, err := makesigcomment(seckeyfile, comment)
+	if err != nil {
+		return err
+	}
+	return writeb64file(sigfile, sigcomment, &sig, nil, os.O_TRUNC, 0666)
+}
+
+func parsephsig(buf []byte) (*sig, error) {
+	s := new(sig)
+	if len(buf) != binary.Size(s) {
+		return nil, errors.New("invalid signature")
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// verifyph verifies the Ed25519ph signature in buf of msg.
+func verifyph(opts *verifyopts, sigcomment string, buf []byte, msg *message) error {
+	s, err := parsephsig(buf)
+	if err != nil {
+		return err
+	}
+	if len(opts.pubkeyfiles) > 1 || opts.threshold > 0 {
+		return errors.New("prehashed signature requires a single public key")
+	}
+	if opts.namespace != "" {
+		return fmt.Errorf("signature not made in namespace %s", opts.namespace)
+	}
+	key, err := opts.readkey(sigcomment, buf)
+	if err != nil {
+		return err
+	}
+	if len(opts.chain) > 0 {
+		if key, err = chainkey(key, opts.chain, s.Keynum, opts.revocations); err != nil {
+			return err
+		}
+	}
+	if err := opts.checkrevoked(s.Keynum); err != nil {
+		return err
+	}
+	if s.Keynum != key.Keynum {
+		return errors.New("verification failed: checked against wrong key")
+	}
+	digest, err := msg.sha512()
+	if err != nil {
+		return err
+	}
+	err = ed25519.VerifyWithOptions(key.Pubkey[:], digest, s.Sig[:], &ed25519.Options{Hash: crypto.SHA512})
+	if err != nil {
+		return errors.New("signature verification failed")
+	}
+	if !opts.quiet {
+		fmt.Println("Signature Verified")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrehashed(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	sigfile := msgfile + ".sig"
+	if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-ph", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// prehashed signatures are marked as such
+	_, buf, err := readb64file(sigfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:2]) != phalg {
+		t.Errorf("unexpected algorithm %s", buf[:2])
+	}
+	if _, err := parsesigs(buf); err == nil {
+		t.Error("should fail")
+	}
+	// modified message
+	if err := ioutil.WriteFile(msgfile, []byte("modified\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-S", "-ph", "-e", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
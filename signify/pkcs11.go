@@ -0,0 +1,319 @@
+// +build cgo
+
+package signify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/pkcs11uri"
+	"github.com/frankbraun/gosignify/internal/util"
+	"github.com/miekg/pkcs11"
+)
+
+// PKCS#11 v3.0 constants for Ed25519, which are missing in the binding.
+const (
+	ckmECEdwardsKeyPairGen = 0x00001055
+	ckmEdDSA               = 0x00001057
+	ckkECEdwards           = 0x00000040
+)
+
+const pkcs11moduleenv = "GOSIGNIFY_PKCS11_MODULE"
+
+// ed25519oid is the DER encoded object identifier of Ed25519 (RFC 8410),
+// used as CKA_EC_PARAMS.
+var ed25519oid = []byte{0x06, 0x03, 0x2b, 0x65, 0x70}
+
+// pkcs11session is a logged in session with the token denoted by a PKCS#11
+// URI.
+type pkcs11session struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	uri     *pkcs11uri.URI
+}
+
+func pkcs11pin(uri *pkcs11uri.URI) (string, error) {
+	if pin, ok := uri.Query["pin-value"]; ok {
+		return pin, nil
+	}
+	if file, ok := uri.Query["pin-source"]; ok {
+		pin, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return string(bytes.TrimRight(pin, "\r\n")), nil
+	}
+	pin, err := readpassphrase("PIN", false)
+	if err != nil {
+		return "", err
+	}
+	defer util.MunlockBytes(pin)
+	defer util.BzeroBytes(pin)
+	return string(pin), nil
+}
+
+func pkcs11slot(ctx *pkcs11.Ctx, uri *pkcs11uri.URI) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+	var found []uint
+	for _, slot := range slots {
+		if id, ok := uri.Path["slot-id"]; ok && id != fmt.Sprint(slot) {
+			continue
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return 0, err
+		}
+		if label, ok := uri.Path["token"]; ok && label != info.Label {
+			continue
+		}
+		if serial, ok := uri.Path["serial"]; ok && serial != info.SerialNumber {
+			continue
+		}
+		found = append(found, slot)
+	}
+	switch len(found) {
+	case 0:
+		return 0, errors.New("PKCS#11 token not found")
+	case 1:
+		return found[0], nil
+	default:
+		return 0, errors.New("PKCS#11 URI matches more than one token")
+	}
+}
+
+func openpkcs11(rawuri string, flags uint) (*pkcs11session, error) {
+	uri, err := pkcs11uri.Parse(rawuri)
+	if err != nil {
+		return nil, err
+	}
+	module := uri.Query["module-path"]
+	if module == "" {
+		module = os.Getenv(pkcs11moduleenv)
+	}
+	if module == "" {
+		return nil, errors.New("PKCS#11 URI without module-path")
+	}
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("cannot load PKCS#11 module %s", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+	s := &pkcs11session{ctx: ctx, uri: uri}
+	slot, err := pkcs11slot(ctx, uri)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	s.session, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|flags)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	pin, err := pkcs11pin(uri)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	err = ctx.Login(s.session, pkcs11.CKU_USER, pin)
+	if err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *pkcs11session) close() {
+	if s.session != 0 {
+		s.ctx.Logout(s.session)
+		s.ctx.CloseSession(s.session)
+		s.session = 0
+	}
+	s.ctx.Finalize()
+	s.ctx.Destroy()
+}
+
+// findkey returns the Ed25519 private key denoted by the URI of the session.
+func (s *pkcs11session) findkey() (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, ckkECEdwards),
+	}
+	if label, ok := s.uri.Path["object"]; ok {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+	}
+	if id, ok := s.uri.Path["id"]; ok {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(id)))
+	}
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return 0, err
+	}
+	objs, _, err := s.ctx.FindObjects(s.session, 2)
+	if err != nil {
+		s.ctx.FindObjectsFinal(s.session)
+		return 0, err
+	}
+	if err := s.ctx.FindObjectsFinal(s.session); err != nil {
+		return 0, err
+	}
+	switch len(objs) {
+	case 0:
+		return 0, errors.New("PKCS#11 key not found")
+	case 1:
+		return objs[0], nil
+	default:
+		return 0, errors.New("PKCS#11 URI matches more than one key")
+	}
+}
+
+// pkcs11signer signs messages with an Ed25519 key on a PKCS#11 token. The
+// key number is stored as CKA_ID of the key.
+type pkcs11signer struct {
+	s       *pkcs11session
+	key     pkcs11.ObjectHandle
+	keynum  [keynumlen]byte
+	comment string
+}
+
+func newpkcs11signer(uri string) (signer, error) {
+	s, err := openpkcs11(uri, 0)
+	if err != nil {
+		return nil, err
+	}
+	key, err := s.findkey()
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.session, key, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_ID, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, nil),
+	})
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	if len(attrs[0].Value) != keynumlen {
+		s.close()
+		return nil, errors.New("PKCS#11 key ID is not a key number")
+	}
+	signer := &pkcs11signer{
+		s:       s,
+		key:     key,
+		comment: string(attrs[1].Value),
+	}
+	copy(signer.keynum[:], attrs[0].Value)
+	return signer, nil
+}
+
+func (s *pkcs11signer) Keynum() [keynumlen]byte {
+	return s.keynum
+}
+
+func (s *pkcs11signer) Comment() string {
+	return s.comment
+}
+
+func (s *pkcs11signer) Sign(msg []byte) ([]byte, error) {
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(ckmEdDSA, nil)}
+	if err := s.s.ctx.SignInit(s.s.session, mech, s.key); err != nil {
+		return nil, err
+	}
+	sig, err := s.s.ctx.Sign(s.s.session, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != sigbytes {
+		return nil, errors.New("PKCS#11 token returned invalid signature")
+	}
+	return sig, nil
+}
+
+func (s *pkcs11signer) Close() error {
+	if s.s != nil {
+		s.s.close()
+		s.s = nil
+	}
+	return nil
+}
+
+// ecpoint extracts the Ed25519 public key from CKA_EC_POINT, which is either
+// a DER encoded octet string or the raw public key.
+func ecpoint(point []byte) ([]byte, error) {
+	if len(point) == publicbytes+2 && point[0] == 0x04 && point[1] == publicbytes {
+		return point[2:], nil
+	}
+	if len(point) == publicbytes {
+		return point, nil
+	}
+	return nil, errors.New("invalid PKCS#11 EC point")
+}
+
+// generatepkcs11 generates a new key pair on the PKCS#11 token denoted by uri
+// and writes the public key to pubkeyfile. The secret key never leaves the
+// token.
+func generatepkcs11(pubkeyfile, uri, comment string) error {
+	var pubkey pubkey
+
+	s, err := openpkcs11(uri, pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+	if _, err := io.ReadFull(rand.Reader, pubkey.Keynum[:]); err != nil {
+		return err
+	}
+	label := s.uri.Path["object"]
+	if label == "" {
+		label = comment
+	}
+	public := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, ed25519oid),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, pubkey.Keynum[:]),
+	}
+	private := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_ID, pubkey.Keynum[:]),
+	}
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(ckmECEdwardsKeyPairGen, nil)}
+	pub, _, err := s.ctx.GenerateKeyPair(s.session, mech, public, private)
+	if err != nil {
+		return err
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.session, pub, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return err
+	}
+	point, err := ecpoint(attrs[0].Value)
+	if err != nil {
+		return err
+	}
+	copy(pubkey.Pubkey[:], point)
+	copy(pubkey.Pkalg[:], []byte(pkalg))
+
+	commentbuf := fmt.Sprintf("%s public key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	return writeb64file(pubkeyfile, commentbuf, &pubkey, nil, os.O_EXCL, 0666)
+}
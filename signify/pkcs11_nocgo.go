@@ -0,0 +1,17 @@
+// +build !cgo
+
+package signify
+
+import (
+	"errors"
+)
+
+var errNoPKCS11 = errors.New("PKCS#11 support requires cgo")
+
+func newpkcs11signer(uri string) (signer, error) {
+	return nil, errNoPKCS11
+}
+
+func generatepkcs11(pubkeyfile, uri, comment string) error {
+	return errNoPKCS11
+}
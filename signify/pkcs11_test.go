@@ -0,0 +1,149 @@
+// +build cgo
+
+package signify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+// softhsm returns the path of the SoftHSMv2 PKCS#11 module or skips the test.
+func softhsm(t *testing.T) string {
+	for _, lib := range []string{
+		os.Getenv("SOFTHSM2_LIB"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	} {
+		if lib == "" {
+			continue
+		}
+		if _, err := os.Stat(lib); err == nil {
+			return lib
+		}
+	}
+	t.Skip("SoftHSMv2 not found (set SOFTHSM2_LIB)")
+	return ""
+}
+
+// inittoken initializes a new SoftHSMv2 token with the given label and user
+// PIN.
+func inittoken(lib, label, pin string) error {
+	ctx := pkcs11.New(lib)
+	if ctx == nil {
+		return fmt.Errorf("cannot load %s", lib)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		return err
+	}
+	defer ctx.Finalize()
+	slots, err := ctx.GetSlotList(false)
+	if err != nil {
+		return err
+	}
+	if len(slots) == 0 {
+		return fmt.Errorf("no slots")
+	}
+	if err := ctx.InitToken(slots[0], "so-"+pin, label); err != nil {
+		return err
+	}
+	// SoftHSMv2 reassigns the slot after initialization
+	slots, err = ctx.GetSlotList(true)
+	if err != nil {
+		return err
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			return err
+		}
+		if info.Label != label {
+			continue
+		}
+		session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+		if err != nil {
+			return err
+		}
+		defer ctx.CloseSession(session)
+		if err := ctx.Login(session, pkcs11.CKU_SO, "so-"+pin); err != nil {
+			return err
+		}
+		defer ctx.Logout(session)
+		return ctx.InitPIN(session, pin)
+	}
+	return fmt.Errorf("token %s not found", label)
+}
+
+func TestPKCS11(t *testing.T) {
+	lib := softhsm(t)
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	tokendir := filepath.Join(tmpdir, "tokens")
+	if err := os.Mkdir(tokendir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	conf := filepath.Join(tmpdir, "softhsm2.conf")
+	confdata := fmt.Sprintf("directories.tokendir = %s\nobjectstore.backend = file\n", tokendir)
+	if err := ioutil.WriteFile(conf, []byte(confdata), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SOFTHSM2_CONF", conf)
+	defer os.Unsetenv("SOFTHSM2_CONF")
+	if err := inittoken(lib, "gosignify", "1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	pubkey := filepath.Join(tmpdir, "key.pub")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	uri := "pkcs11:token=gosignify;object=release?module-path=" + lib + "&pin-value=1234"
+
+	// generate key pair on token
+	if err := Main("signify", "-G", "-p", pubkey, "-s", uri); err != nil {
+		t.Fatal(err)
+	}
+	// sign and verify
+	if err := Main("signify", "-S", "-s", uri, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// sign and verify embedded
+	if err := Main("signify", "-S", "-e", "-s", uri, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-e", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// COSE_Sign1 with key on token
+	if err := Main("signify", "-S", "-cose", "-s", uri, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-cose", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// wrong PIN
+	wrongpin := "pkcs11:token=gosignify;object=release?module-path=" + lib + "&pin-value=0000"
+	if err := Main("signify", "-S", "-s", wrongpin, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// unknown key
+	unknown := "pkcs11:token=gosignify;object=unknown?module-path=" + lib + "&pin-value=1234"
+	if err := Main("signify", "-S", "-s", unknown, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
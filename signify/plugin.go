@@ -0,0 +1,139 @@
+package signify
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/plugin"
+)
+
+const pluginscheme = "plugin:"
+
+// pluginsigner signs messages with an external signer plugin.
+type pluginsigner struct {
+	cmd     *exec.Cmd
+	stdin   io.Closer
+	conn    *plugin.Conn
+	keynum  [keynumlen]byte
+	pubkey  [publicbytes]byte
+	comment string
+}
+
+// startplugin starts the plugin for the key URI plugin:NAME:DATA and performs
+// the handshake.
+func startplugin(uri string) (*pluginsigner, error) {
+	parts := strings.SplitN(strings.TrimPrefix(uri, pluginscheme), ":", 2)
+	name := parts[0]
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid plugin name in %s", uri)
+	}
+	var data string
+	if len(parts) == 2 {
+		data = parts[1]
+	}
+	path, err := exec.LookPath(plugin.Prefix + name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	s := &pluginsigner{
+		cmd:   cmd,
+		stdin: stdin,
+		conn:  plugin.NewConn(stdout, stdin),
+	}
+	if err := s.conn.Send(plugin.CmdHello, []byte(plugin.Version), []byte(data)); err != nil {
+		s.Close()
+		return nil, err
+	}
+	args, err := s.conn.Expect(plugin.CmdKey, 3)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("plugin %s: %s", name, err)
+	}
+	if len(args[0]) != keynumlen || len(args[1]) != publicbytes {
+		s.Close()
+		return nil, fmt.Errorf("plugin %s: invalid key", name)
+	}
+	copy(s.keynum[:], args[0])
+	copy(s.pubkey[:], args[1])
+	s.comment = string(args[2])
+	return s, nil
+}
+
+func newpluginsigner(uri string) (signer, error) {
+	return startplugin(uri)
+}
+
+func (s *pluginsigner) Keynum() [keynumlen]byte {
+	return s.keynum
+}
+
+func (s *pluginsigner) Comment() string {
+	return s.comment
+}
+
+func (s *pluginsigner) Sign(msg []byte) ([]byte, error) {
+	if err := s.conn.Send(plugin.CmdSign, msg); err != nil {
+		return nil, err
+	}
+	args, err := s.conn.Expect(plugin.CmdSig, 1)
+	if err != nil {
+		return nil, err
+	}
+	sig := args[0]
+	// make sure the plugin signed with the key it announced
+	if len(sig) != sigbytes || !ed25519.Verify(s.pubkey[:], msg, sig) {
+		return nil, errors.New("plugin returned invalid signature")
+	}
+	return sig, nil
+}
+
+func (s *pluginsigner) Close() error {
+	if s.cmd == nil {
+		return nil
+	}
+	s.conn.Send(plugin.CmdBye)
+	s.stdin.Close()
+	err := s.cmd.Wait()
+	s.cmd = nil
+	return err
+}
+
+// generateplugin writes the public key of the plugin key denoted by uri to
+// pubkeyfile.
+func generateplugin(pubkeyfile, uri, comment string) error {
+	var pubkey pubkey
+
+	s, err := startplugin(uri)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	copy(pubkey.Pkalg[:], []byte(pkalg))
+	pubkey.Keynum = s.keynum
+	pubkey.Pubkey = s.pubkey
+
+	commentbuf := fmt.Sprintf("%s public key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	return writeb64file(pubkeyfile, commentbuf, &pubkey, nil, os.O_EXCL, 0666)
+}
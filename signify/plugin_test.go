@@ -0,0 +1,134 @@
+package signify
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frankbraun/gosignify/internal/plugin"
+)
+
+const testpluginenv = "GOSIGNIFY_TEST_PLUGIN"
+
+// fakeplugin derives its key from the plugin data. With data "bad" it
+// returns invalid signatures, with data "fail" it refuses to start.
+type fakeplugin struct {
+	key ed25519.PrivateKey
+	bad bool
+}
+
+func openfakeplugin(data string) (plugin.Signer, error) {
+	if data == "fail" {
+		return nil, errors.New("fake plugin failure")
+	}
+	seed := sha256.Sum256([]byte(data))
+	return &fakeplugin{
+		key: ed25519.NewKeyFromSeed(seed[:]),
+		bad: data == "bad",
+	}, nil
+}
+
+func (p *fakeplugin) Keynum() [plugin.KeynumSize]byte {
+	var keynum [plugin.KeynumSize]byte
+	copy(keynum[:], p.key.Public().(ed25519.PublicKey))
+	return keynum
+}
+
+func (p *fakeplugin) PublicKey() ed25519.PublicKey {
+	return p.key.Public().(ed25519.PublicKey)
+}
+
+func (p *fakeplugin) Comment() string {
+	return "fake plugin"
+}
+
+func (p *fakeplugin) Sign(msg []byte) ([]byte, error) {
+	if p.bad {
+		msg = append([]byte("bad"), msg...)
+	}
+	return ed25519.Sign(p.key, msg), nil
+}
+
+// TestMain runs the test binary as fake plugin, if requested.
+func TestMain(m *testing.M) {
+	if os.Getenv(testpluginenv) != "" {
+		if err := plugin.Serve(os.Stdin, os.Stdout, openfakeplugin); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestPlugin(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	// install test binary as plugin gosignify-plugin-fake
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(exe, filepath.Join(tmpdir, plugin.Prefix+"fake")); err != nil {
+		t.Skip("cannot create symlink:", err)
+	}
+	path := os.Getenv("PATH")
+	defer os.Setenv("PATH", path)
+	os.Setenv("PATH", strings.Join([]string{tmpdir, path}, string(os.PathListSeparator)))
+	os.Setenv(testpluginenv, "1")
+	defer os.Unsetenv(testpluginenv)
+
+	pubkey := filepath.Join(tmpdir, "key.pub")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// export public key of plugin key
+	if err := Main("signify", "-G", "-p", pubkey, "-s", "plugin:fake:alice"); err != nil {
+		t.Fatal(err)
+	}
+	// sign and verify
+	if err := Main("signify", "-S", "-s", "plugin:fake:alice", "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// DSSE envelope with plugin key
+	if err := Main("signify", "-S", "-dsse", "-s", "plugin:fake:alice", "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-dsse", "-q", "-p", pubkey, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// different key
+	if err := Main("signify", "-S", "-s", "plugin:fake:bob", "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkey, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// invalid signature
+	if err := Main("signify", "-S", "-s", "plugin:fake:bad", "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// plugin refuses to start
+	if err := Main("signify", "-S", "-s", "plugin:fake:fail", "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// plugin does not exist
+	if err := Main("signify", "-S", "-s", "plugin:doesnotexist:", "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// invalid plugin name
+	if err := Main("signify", "-S", "-s", "plugin:../fake:alice", "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,349 @@
+package signify
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AllowedSigner is an entry of an allowed signers file. Each line of the file
+// consists of a comma-separated list of principals, optional options, and the
+// base64 encoded public key as found in the second line of a public key file:
+//
+//	alice@example.com namespaces="release,git",valid-before=2027-01-01 RWQ...
+//
+// The options are namespaces, valid-after, valid-before (YYYY-MM-DD or RFC
+// 3339), and files, a comma-separated list of shell patterns. Patterns
+// without a slash are matched against the base name of the signed file.
+// Empty lines and lines starting with # are ignored.
+type AllowedSigner struct {
+	Principals  []string
+	Namespaces  []string  // namespaces the key may sign in, any if empty
+	ValidAfter  time.Time // zero if unrestricted
+	ValidBefore time.Time // zero if unrestricted
+	Files       []string  // patterns of file names the key may sign, any if empty
+	Keynum      [keynumlen]byte
+	Pubkey      [publicbytes]byte
+}
+
+// Policy is a list of allowed signers.
+type Policy struct {
+	Signers []AllowedSigner
+}
+
+// Principal returns the principals of s.
+func (s *AllowedSigner) Principal() string {
+	return strings.Join(s.Principals, ",")
+}
+
+// splitquoted splits s at runes for which sep returns true, unless they are
+// enclosed in double quotes. Quotes are retained.
+func splitquoted(s string, sep func(rune) bool) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quoted bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			field.WriteRune(r)
+		case !quoted && sep(r):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func splitlist(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// parsesigner parses a line of an allowed signers file.
+func parsesigner(line string) (*AllowedSigner, error) {
+	fields, err := splitquoted(line, func(r rune) bool { return r == ' ' || r == '\t' })
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, errors.New("expected principals, options and key")
+	}
+	s := &AllowedSigner{Principals: splitlist(unquote(fields[0]))}
+	if len(s.Principals) == 0 {
+		return nil, errors.New("missing principals")
+	}
+	if len(fields) == 3 {
+		opts, err := splitquoted(fields[1], func(r rune) bool { return r == ',' })
+		if err != nil {
+			return nil, err
+		}
+		for _, opt := range opts {
+			kv := strings.SplitN(opt, "=", 2)
+			if len(kv) != 2 {
+				return nil, fmt.Errorf("option %s requires a value", opt)
+			}
+			value := unquote(kv[1])
+			switch kv[0] {
+			case "namespaces":
+				s.Namespaces = splitlist(value)
+			case "valid-after":
+				if s.ValidAfter, err = parsetime(value); err != nil {
+					return nil, err
+				}
+			case "valid-before":
+				if s.ValidBefore, err = parsetime(value); err != nil {
+					return nil, err
+				}
+			case "files":
+				s.Files = splitlist(value)
+				for _, pattern := range s.Files {
+					if _, err := filepath.Match(pattern, ""); err != nil {
+						return nil, fmt.Errorf("invalid file name pattern %s", pattern)
+					}
+				}
+			default:
+				return nil, fmt.Errorf("unknown option %s", kv[0])
+			}
+		}
+	}
+	buf, err := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+	if err != nil {
+		return nil, errors.New("invalid base64 encoding of key")
+	}
+	var key pubkey
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &key); err != nil || len(buf) != 2+keynumlen+publicbytes {
+		return nil, errors.New("invalid key")
+	}
+	if string(key.Pkalg[:]) != pkalg {
+		return nil, errors.New("unsupported key")
+	}
+	s.Keynum = key.Keynum
+	s.Pubkey = key.Pubkey
+	return s, nil
+}
+
+// ParsePolicy parses an allowed signers file from r.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	p := new(Policy)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s, err := parsesigner(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		p.Signers = append(p.Signers, *s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReadPolicy reads the allowed signers file filename.
+func ReadPolicy(filename string) (*Policy, error) {
+	fd, err := xopen(filename, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	p, err := ParsePolicy(fd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return p, nil
+}
+
+// keys returns the public keys of all allowed signers.
+func (p *Policy) keys() []pubkey {
+	keys := make([]pubkey, len(p.Signers))
+	for i, s := range p.Signers {
+		copy(keys[i].Pkalg[:], []byte(pkalg))
+		keys[i].Keynum = s.Keynum
+		keys[i].Pubkey = s.Pubkey
+	}
+	return keys
+}
+
+// allow checks that s may sign the file name in namespace at time t.
+func (s *AllowedSigner) allow(t time.Time, namespace, name string) error {
+	if !s.ValidAfter.IsZero() && t.Before(s.ValidAfter) {
+		return fmt.Errorf("%s: key not valid before %s", s.Principal(),
+			s.ValidAfter.UTC().Format(time.RFC3339))
+	}
+	if !s.ValidBefore.IsZero() && !t.Before(s.ValidBefore) {
+		return fmt.Errorf("%s: key expired at %s", s.Principal(),
+			s.ValidBefore.UTC().Format(time.RFC3339))
+	}
+	if len(s.Namespaces) > 0 {
+		allowed := false
+		for _, ns := range s.Namespaces {
+			allowed = allowed || ns == namespace
+		}
+		if !allowed {
+			return fmt.Errorf("%s may only sign in namespaces %s", s.Principal(),
+				strings.Join(s.Namespaces, ","))
+		}
+	}
+	if len(s.Files) > 0 {
+		allowed := false
+		for _, pattern := range s.Files {
+			path := filepath.Base(name)
+			if strings.Contains(pattern, "/") {
+				path = filepath.ToSlash(filepath.Clean(name))
+			}
+			ok, _ := filepath.Match(pattern, path)
+			allowed = allowed || ok
+		}
+		if !allowed {
+			return fmt.Errorf("%s may only sign files matching %s", s.Principal(),
+				strings.Join(s.Files, ","))
+		}
+	}
+	return nil
+}
+
+// Allow returns the allowed signer with the key number keynum which may sign
+// the file name in namespace at time t.
+func (p *Policy) Allow(keynum [keynumlen]byte, t time.Time, namespace, name string) (*AllowedSigner, error) {
+	var err error
+	for i := range p.Signers {
+		s := &p.Signers[i]
+		if s.Keynum != keynum {
+			continue
+		}
+		e := s.allow(t, namespace, name)
+		if e == nil {
+			return s, nil
+		}
+		if err == nil {
+			err = e
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("key %s is not an allowed signer", hex.EncodeToString(keynum[:]))
+	}
+	return nil, err
+}
+
+// sigkeynum returns the key number of the key which made the signature in
+// buf. For signatures of subkeys, it is the key number of the master key.
+func sigkeynum(buf []byte) ([keynumlen]byte, error) {
+	switch string(buf[:2]) {
+	case certsigalg:
+		_, c, err := splitcertsig(buf)
+		if err != nil {
+			return [keynumlen]byte{}, err
+		}
+		return c.Keynum, nil
+	case extsigalg:
+		s, _, _, err := splitextsig(buf)
+		if err != nil {
+			return [keynumlen]byte{}, err
+		}
+		return s.Keynum, nil
+	case phalg:
+		s, err := parsephsig(buf)
+		if err != nil {
+			return [keynumlen]byte{}, err
+		}
+		return s.Keynum, nil
+	case multisigalg:
+		return [keynumlen]byte{}, errors.New("multi-signatures cannot be verified with allowed signers")
+	}
+	sigs, err := parsesigs(buf)
+	if err != nil {
+		return [keynumlen]byte{}, err
+	}
+	return sigs[0].Keynum, nil
+}
+
+// verifypolicy verifies msg, named name, against the signature in buf with
+// the allowed signer of opts.policy who made it and returns its principals.
+func verifypolicy(opts *verifyopts, name string, buf []byte, msg *message) (string, error) {
+	if len(opts.pubkeyfiles) > 0 || len(opts.chain) > 0 || opts.threshold > 0 {
+		return "", errors.New("allowed signers cannot be combined with public keys")
+	}
+	keynum, err := sigkeynum(buf)
+	if err != nil {
+		return "", err
+	}
+	s, err := opts.policy.Allow(keynum, time.Now(), opts.namespace, name)
+	if err != nil {
+		return "", err
+	}
+	key := pubkey{Keynum: s.Keynum, Pubkey: s.Pubkey}
+	copy(key.Pkalg[:], []byte(pkalg))
+	o := *opts
+	o.policy = nil
+	o.key = &key
+	if err := verifysigs(&o, "", name, buf, msg); err != nil {
+		return "", err
+	}
+	if !opts.quiet {
+		fmt.Printf("Signed by %s\n", s.Principal())
+	}
+	return s.Principal(), nil
+}
+
+// Verify verifies the signature in sigfile of msgfile, made in namespace,
+// with the allowed signers and returns the principals of the signer. If
+// sigfile is empty, msgfile.sig is used. Signatures made with keys revoked by
+// one of the revocation lists are rejected.
+func (p *Policy) Verify(msgfile, sigfile, namespace string, revocations ...*RevocationList) (string, error) {
+	if sigfile == "" {
+		sigfile = msgfile + ".sig"
+	}
+	msg, err := readmessage(msgfile)
+	if err != nil {
+		return "", err
+	}
+	_, buf, err := readb64file(sigfile)
+	if err != nil {
+		return "", err
+	}
+	opts := &verifyopts{
+		policy:      p,
+		namespace:   namespace,
+		revocations: revocations,
+		quiet:       true,
+	}
+	return verifypolicy(opts, msgfile, buf, msg)
+}
@@ -0,0 +1,156 @@
+package signify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	b64key := make(map[string]string)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		pubkeyfile := filepath.Join(tmpdir, name+".pub")
+		seckeyfile := filepath.Join(tmpdir, name+".sec")
+		if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+			t.Fatal(err)
+		}
+		buf, err := ioutil.ReadFile(pubkeyfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b64key[name] = strings.TrimSpace(strings.SplitN(string(buf), "\n", 2)[1])
+	}
+	policyfile := filepath.Join(tmpdir, "allowed_signers")
+	policy := fmt.Sprintf(`# release signers
+alice@example.com,release@example.com namespaces="release,git",files="*.tgz" %s
+bob@example.com valid-before=2000-01-01 %s
+`, b64key["alice"], b64key["bob"])
+	if err := ioutil.WriteFile(policyfile, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msgfile := filepath.Join(tmpdir, "release.tgz")
+	otherfile := filepath.Join(tmpdir, "other.txt")
+	for _, file := range []string{msgfile, otherfile} {
+		if err := createMsgfile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := filepath.Join(tmpdir, "alice.sec")
+	if err := Main("signify", "-S", "-namespace", "release", "-s", alice, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-policy", policyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadPolicy(policyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principal, err := p.Verify(msgfile, "", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal != "alice@example.com,release@example.com" {
+		t.Errorf("unexpected principal %s", principal)
+	}
+	// namespace not allowed
+	if err := Main("signify", "-S", "-namespace", "firmware", "-s", alice, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(msgfile, "", "firmware"); err == nil {
+		t.Error("should fail")
+	}
+	// file not allowed
+	if err := Main("signify", "-S", "-namespace", "release", "-s", alice, "-m", otherfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(otherfile, "", "release"); err == nil {
+		t.Error("should fail")
+	}
+	// key expired
+	if err := Main("signify", "-S", "-s", filepath.Join(tmpdir, "bob.sec"), "-m", otherfile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(otherfile, "", ""); err == nil {
+		t.Error("should fail")
+	}
+	// unknown key
+	if err := Main("signify", "-S", "-s", filepath.Join(tmpdir, "carol.sec"), "-m", otherfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-policy", policyfile, "-m", otherfile); err == nil {
+		t.Error("should fail")
+	}
+	// policy and public key
+	if err := Main("signify", "-V", "-q", "-policy", policyfile, "-p", filepath.Join(tmpdir, "carol.pub"),
+		"-m", otherfile); err == nil {
+		t.Error("should fail")
+	}
+	// revocation lists must be signed by the revoker, not by another signer
+	rootpub := filepath.Join(tmpdir, "root.pub")
+	rootsec := filepath.Join(tmpdir, "root.sec")
+	if err := Main("signify", "-G", "-n", "-p", rootpub, "-s", rootsec); err != nil {
+		t.Fatal(err)
+	}
+	forged := filepath.Join(tmpdir, "forged.list")
+	if err := Main("signify", "-revoke", "-s", alice, "-p", filepath.Join(tmpdir, "bob.pub"), "-x", forged); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", forged, "-policy", policyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", forged, "-revoker", rootpub, "-policy", policyfile,
+		"-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	list := filepath.Join(tmpdir, "revoked.list")
+	if err := Main("signify", "-revoke", "-reason", "key leaked", "-s", rootsec,
+		"-p", filepath.Join(tmpdir, "alice.pub"), "-x", list); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-namespace", "release", "-s", alice, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	err = Main("signify", "-V", "-q", "-namespace", "release", "-revoked", list, "-revoker", rootpub,
+		"-policy", policyfile, "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "key leaked") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	key := "RWQAAQIDBAUGBwAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	valid := []string{
+		"alice " + key,
+		"alice namespaces=release " + key,
+		`"alice,bob" valid-after=2020-01-01,valid-before=2030-01-01T00:00:00Z,files="dist/*.tgz,*.sha256" ` + key,
+	}
+	for _, line := range valid {
+		if _, err := ParsePolicy(strings.NewReader(line)); err != nil {
+			t.Errorf("%s: %s", line, err)
+		}
+	}
+	invalid := []string{
+		key,
+		"alice foo=bar " + key,
+		"alice namespaces " + key,
+		"alice valid-after=tomorrow " + key,
+		`alice files="[" ` + key,
+		`alice files="*.tgz ` + key,
+		"alice RWQAAQ==",
+		"alice " + key + " trailing garbage",
+	}
+	for _, line := range invalid {
+		if _, err := ParsePolicy(strings.NewReader(line)); err == nil {
+			t.Errorf("%s: should fail", line)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package signify
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/bech32"
+	"github.com/frankbraun/gosignify/internal/util"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	recipientalg    = "AX" // encrypted to age X25519 recipients
+	identityenv     = "GOSIGNIFY_IDENTITY"
+	recipienthrp    = "age"
+	identityhrp     = "age-secret-key-"
+	x25519label     = "age-encryption.org/v1/X25519"
+	recipientlabel  = "gosignify recipients v1"
+	filekeybytes    = 16
+	x25519bytes     = 32
+	recipientsmax   = 255
+	recipientnonce0 = "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+)
+
+// recipientkey is a secret key encrypted to X25519 recipients like age does:
+// the secret key is encrypted with XChaCha20-Poly1305 under a key derived
+// from a random file key, which is wrapped for every recipient in a stanza
+// following the key. The header and the stanzas are authenticated as
+// associated data.
+type recipientkey struct {
+	Pkalg  [2]byte
+	Kdfalg [2]byte
+	Keynum [keynumlen]byte
+	Nonce  [chacha20poly1305.NonceSizeX]byte
+	Seckey [secretbytes + argontagbytes]byte
+}
+
+// stanza is the file key wrapped for one recipient, as in age.
+type stanza struct {
+	Ephemeral [x25519bytes]byte
+	Filekey   [filekeybytes + argontagbytes]byte
+}
+
+// parserecipient parses an age X25519 recipient (age1...).
+func parserecipient(s string) (*ecdh.PublicKey, error) {
+	hrp, data, err := bech32.Decode(s)
+	if err != nil || hrp != recipienthrp || s != strings.ToLower(s) {
+		return nil, fmt.Errorf("invalid recipient %s", s)
+	}
+	key, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient %s", s)
+	}
+	return key, nil
+}
+
+// readrecipients parses the given recipients, each of which is either an age
+// X25519 recipient or a file containing one recipient per line.
+func readrecipients(args []string) ([]*ecdh.PublicKey, error) {
+	var recipients []*ecdh.PublicKey
+	for _, arg := range args {
+		if strings.HasPrefix(arg, recipienthrp+"1") {
+			key, err := parserecipient(arg)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, key)
+			continue
+		}
+		fd, err := os.Open(arg)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			key, err := parserecipient(line)
+			if err != nil {
+				fd.Close()
+				return nil, fmt.Errorf("%s: %s", arg, err)
+			}
+			recipients = append(recipients, key)
+		}
+		err = scanner.Err()
+		fd.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(recipients) > recipientsmax {
+		return nil, errors.New("too many recipients")
+	}
+	return recipients, nil
+}
+
+// readidentities reads the age X25519 identities (AGE-SECRET-KEY-1...) in the
+// identity file filename. Other lines must be empty or comments.
+func readidentities(filename string) ([]*ecdh.PrivateKey, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer util.BzeroBytes(data)
+	var identities []*ecdh.PrivateKey
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hrp, key, err := bech32.Decode(line)
+		if err != nil || hrp != identityhrp {
+			return nil, fmt.Errorf("%s: invalid identity", filename)
+		}
+		identity, err := ecdh.X25519().NewPrivateKey(key)
+		util.BzeroBytes(key) // wipe early, wipe often
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid identity", filename)
+		}
+		identities = append(identities, identity)
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%s: no identities", filename)
+	}
+	return identities, nil
+}
+
+// wrapkey returns the key wrapping the file key for recipient, derived from
+// the shared secret of the ephemeral key and recipient as in age.
+func wrapkey(shared, ephemeral, recipient []byte) ([]byte, error) {
+	if bytes.Equal(shared, make([]byte, len(shared))) {
+		return nil, errors.New("invalid X25519 shared secret")
+	}
+	salt := append(append([]byte{}, ephemeral...), recipient...)
+	return hkdfkey(shared, salt, x25519label)
+}
+
+// hkdfkey derives a ChaCha20-Poly1305 key with HKDF-SHA-256.
+func hkdfkey(secret, salt []byte, info string) ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// recipientheader returns the authenticated data of the key k and stanzas.
+func recipientheader(k *recipientkey, stanzas []stanza) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, k)
+	buf.Truncate(buf.Len() - len(k.Seckey))
+	binary.Write(&buf, binary.BigEndian, stanzas)
+	return buf.Bytes()
+}
+
+// seckeyaead returns the AEAD encrypting the secret key under filekey.
+func seckeyaead(filekey []byte) (cipher.AEAD, error) {
+	key, err := hkdfkey(filekey, nil, recipientlabel)
+	if err != nil {
+		return nil, err
+	}
+	defer util.BzeroBytes(key)
+	return chacha20poly1305.NewX(key)
+}
+
+// encryptrecipients encrypts the decrypted secret key in enckey to the
+// recipients and returns the encrypted key.
+func encryptrecipients(enckey *enckey, recipients []*ecdh.PublicKey) ([]byte, error) {
+	var filekey [filekeybytes]byte
+	util.MlockBytes(filekey[:])
+	defer util.MunlockBytes(filekey[:])
+	defer util.BzeroBytes(filekey[:])
+
+	if len(recipients) == 0 || len(recipients) > recipientsmax {
+		return nil, errors.New("invalid number of recipients")
+	}
+	if _, err := io.ReadFull(rand.Reader, filekey[:]); err != nil {
+		return nil, err
+	}
+	stanzas := make([]stanza, len(recipients))
+	for i, recipient := range recipients {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		shared, err := ephemeral.ECDH(recipient)
+		if err != nil {
+			return nil, err
+		}
+		copy(stanzas[i].Ephemeral[:], ephemeral.PublicKey().Bytes())
+		key, err := wrapkey(shared, stanzas[i].Ephemeral[:], recipient.Bytes())
+		util.BzeroBytes(shared) // wipe early, wipe often
+		if err != nil {
+			return nil, err
+		}
+		aead, err := chacha20poly1305.New(key)
+		util.BzeroBytes(key) // wipe early, wipe often
+		if err != nil {
+			return nil, err
+		}
+		aead.Seal(stanzas[i].Filekey[:0], []byte(recipientnonce0), filekey[:], nil)
+	}
+
+	k := new(recipientkey)
+	copy(k.Pkalg[:], []byte(pkalg))
+	copy(k.Kdfalg[:], []byte(recipientalg))
+	k.Keynum = enckey.Keynum
+	if _, err := io.ReadFull(rand.Reader, k.Nonce[:]); err != nil {
+		return nil, err
+	}
+	aead, err := seckeyaead(filekey[:])
+	if err != nil {
+		return nil, err
+	}
+	aead.Seal(k.Seckey[:0], k.Nonce[:], enckey.Seckey[:], recipientheader(k, stanzas))
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, k)
+	binary.Write(&buf, binary.BigEndian, stanzas)
+	return buf.Bytes(), nil
+}
+
+// parserecipientkey parses the secret key encrypted to recipients in buf.
+func parserecipientkey(buf []byte) (*recipientkey, []stanza, error) {
+	var k recipientkey
+	size := binary.Size(&k)
+	stanzasize := binary.Size(&stanza{})
+	n := (len(buf) - size) / stanzasize
+	if len(buf) < size+stanzasize || (len(buf)-size)%stanzasize != 0 || n > recipientsmax {
+		return nil, nil, errors.New("invalid secret key")
+	}
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, &k); err != nil {
+		return nil, nil, err
+	}
+	stanzas := make([]stanza, n)
+	if err := binary.Read(r, binary.BigEndian, stanzas); err != nil {
+		return nil, nil, err
+	}
+	return &k, stanzas, nil
+}
+
+// decryptrecipients decrypts the secret key in buf, encrypted to recipients,
+// into enckey with the identities in the identity file named by
+// $GOSIGNIFY_IDENTITY.
+func decryptrecipients(buf []byte, enckey *enckey) error {
+	var filekey [filekeybytes]byte
+	util.MlockBytes(filekey[:])
+	defer util.MunlockBytes(filekey[:])
+	defer util.BzeroBytes(filekey[:])
+
+	k, stanzas, err := parserecipientkey(buf)
+	if err != nil {
+		return err
+	}
+	identityfile := os.Getenv(identityenv)
+	if identityfile == "" {
+		return fmt.Errorf("secret key is encrypted to recipients, set $%s to an identity file", identityenv)
+	}
+	identities, err := readidentities(identityfile)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, identity := range identities {
+		recipient := identity.PublicKey().Bytes()
+		for _, s := range stanzas {
+			ephemeral, err := ecdh.X25519().NewPublicKey(s.Ephemeral[:])
+			if err != nil {
+				continue
+			}
+			shared, err := identity.ECDH(ephemeral)
+			if err != nil {
+				continue
+			}
+			key, err := wrapkey(shared, s.Ephemeral[:], recipient)
+			util.BzeroBytes(shared) // wipe early, wipe often
+			if err != nil {
+				continue
+			}
+			aead, err := chacha20poly1305.New(key)
+			util.BzeroBytes(key) // wipe early, wipe often
+			if err != nil {
+				return err
+			}
+			if _, err := aead.Open(filekey[:0], []byte(recipientnonce0), s.Filekey[:], nil); err == nil {
+				found = true
+				break
+			}
+		}
+		if found {
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("no identity in %s matches a recipient of the secret key", identityfile)
+	}
+	aead, err := seckeyaead(filekey[:])
+	if err != nil {
+		return err
+	}
+	copy(enckey.Pkalg[:], k.Pkalg[:])
+	copy(enckey.Kdfalg[:], k.Kdfalg[:])
+	enckey.Keynum = k.Keynum
+	if _, err := aead.Open(enckey.Seckey[:0], k.Nonce[:], k.Seckey[:], recipientheader(k, stanzas)); err != nil {
+		return errors.New("secret key was modified")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package signify
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/frankbraun/gosignify/internal/bech32"
+)
+
+// newidentity writes a new age X25519 identity to filename and returns its
+// recipient.
+func newidentity(t *testing.T, filename string) string {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, err := bech32.Encode(identityhrp, key.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := bech32.Encode(recipienthrp, key.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := "# public key: " + recipient + "\n" + strings.ToUpper(identity) + "\n"
+	if err := ioutil.WriteFile(filename, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return recipient
+}
+
+func TestRecipients(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	defer os.Unsetenv(identityenv)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	alice := filepath.Join(tmpdir, "alice.txt")
+	bob := filepath.Join(tmpdir, "bob.txt")
+	mallory := filepath.Join(tmpdir, "mallory.txt")
+	recipients := filepath.Join(tmpdir, "recipients.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	r := newidentity(t, alice)
+	if err := ioutil.WriteFile(recipients, []byte("# security team\n"+newidentity(t, bob)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newidentity(t, mallory)
+	if err := Main("signify", "-G", "-r", r, "-r", recipients, "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail without identity")
+	}
+	for _, identity := range []string{alice, bob} {
+		os.Setenv(identityenv, identity)
+		if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+			t.Fatal(err)
+		}
+		if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv(identityenv, mallory)
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// the recipients are authenticated
+	comment, buf, err := readb64file(seckeyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf = buf[:len(buf)-binary.Size(&stanza{})]
+	tampered := filepath.Join(tmpdir, "tampered.sec")
+	if err := writeb64file(tampered, comment, buf, nil, os.O_EXCL, 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(identityenv, alice)
+	if err := Main("signify", "-S", "-s", tampered, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+
+	// migrate a key protected with a passphrase
+	if err := Main("signify", "-G", "-n", "-p", filepath.Join(tmpdir, "n.pub"), "-s", filepath.Join(tmpdir, "n.sec")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-migrate", "-r", recipients, "-s", filepath.Join(tmpdir, "n.sec")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", filepath.Join(tmpdir, "n.sec"), "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	os.Setenv(identityenv, bob)
+	if err := Main("signify", "-S", "-s", filepath.Join(tmpdir, "n.sec"), "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", filepath.Join(tmpdir, "n.pub"), "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-r", "age1invalid", "-p", filepath.Join(tmpdir, "x.pub"), "-s", filepath.Join(tmpdir, "x.sec")); err == nil {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,275 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	revlistalg     = "RL"
+	revlistcontext = "gosignify revocation list v1\x00"
+)
+
+// revlist is the header of a revocation list file. It is followed by the
+// revoked entries.
+type revlist struct {
+	Pkalg  [2]byte
+	Keynum [keynumlen]byte // of the key which signed the list
+	Sig    [sigbytes]byte
+	Issued int64
+}
+
+// revoked is a revocation list entry. It is followed by the reason, preceded
+// by its length as uint16.
+type revoked struct {
+	Keynum [keynumlen]byte
+	Time   int64
+}
+
+// Revocation is the revocation of a key.
+type Revocation struct {
+	Keynum [keynumlen]byte // key number of the revoked key
+	Time   time.Time       // time from which on the key is revoked
+	Reason string          // reason for the revocation
+}
+
+// RevocationList is a list of revoked keys signed by a trusted key.
+type RevocationList struct {
+	Keynum  [keynumlen]byte // key number of the key which signed the list
+	Issued  time.Time       // time at which the list was signed
+	Entries []Revocation
+}
+
+// RevokedError is returned if a signature was made with a revoked key.
+type RevokedError struct {
+	Revocation
+}
+
+func (e *RevokedError) Error() string {
+	return fmt.Sprintf("key %s revoked at %s: %s", hex.EncodeToString(e.Keynum[:]),
+		e.Time.UTC().Format(time.RFC3339), e.Reason)
+}
+
+// revlistmsg returns the signed part of the revocation list l.
+func revlistmsg(l *RevocationList) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(revlistcontext)
+	binary.Write(&buf, binary.BigEndian, l.Issued.Unix())
+	for _, e := range l.Entries {
+		buf.Write(e.Keynum[:])
+		binary.Write(&buf, binary.BigEndian, e.Time.Unix())
+		writestring(&buf, e.Reason)
+	}
+	return buf.Bytes()
+}
+
+// parserevlist parses the revocation list in buf and returns it together with
+// its signature.
+func parserevlist(buf []byte) (*RevocationList, []byte, error) {
+	var hdr revlist
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, nil, errors.New("invalid revocation list")
+	}
+	if string(hdr.Pkalg[:]) != revlistalg {
+		return nil, nil, errors.New("not a revocation list")
+	}
+	l := &RevocationList{Keynum: hdr.Keynum, Issued: time.Unix(hdr.Issued, 0)}
+	for r.Len() > 0 {
+		var e revoked
+		if err := binary.Read(r, binary.BigEndian, &e); err != nil {
+			return nil, nil, errors.New("invalid revocation list")
+		}
+		reason, err := readstring(r)
+		if err != nil {
+			return nil, nil, errors.New("invalid revocation list")
+		}
+		l.Entries = append(l.Entries, Revocation{Keynum: e.Keynum, Time: time.Unix(e.Time, 0), Reason: reason})
+	}
+	return l, hdr.Sig[:], nil
+}
+
+// verifyrevlist verifies that the revocation list in filename was signed by
+// one of the given keys.
+func verifyrevlist(filename string, keys []pubkey) (*RevocationList, error) {
+	_, buf, err := readb64file(filename)
+	if err != nil {
+		return nil, err
+	}
+	l, sig, err := parserevlist(buf)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if key.Keynum != l.Keynum {
+			continue
+		}
+		if !ed25519.Verify(key.Pubkey[:], revlistmsg(l), sig) {
+			return nil, fmt.Errorf("revocation list %s: signature verification failed", filename)
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("revocation list %s not signed by a trusted key", filename)
+}
+
+// ReadRevocationList reads the revocation list in filename and verifies that
+// it was signed by the key in pubkeyfile.
+func ReadRevocationList(filename, pubkeyfile string) (*RevocationList, error) {
+	keys := make([]pubkey, 1)
+	if err := readpubkeyfile(pubkeyfile, &keys[0]); err != nil {
+		return nil, err
+	}
+	return verifyrevlist(filename, keys)
+}
+
+// Check returns a *RevokedError if the key with key number keynum is revoked
+// at time t.
+func (l *RevocationList) Check(keynum [keynumlen]byte, t time.Time) error {
+	for _, e := range l.Entries {
+		if e.Keynum == keynum && !t.Before(e.Time) {
+			return &RevokedError{e}
+		}
+	}
+	return nil
+}
+
+// revoked returns a *RevokedError if the key with key number keynum is
+// revoked at any time.
+func (l *RevocationList) revoked(keynum [keynumlen]byte) error {
+	for _, e := range l.Entries {
+		if e.Keynum == keynum {
+			return &RevokedError{e}
+		}
+	}
+	return nil
+}
+
+// Verify verifies the signature in sigfile of msgfile with the public key in
+// pubkeyfile. If sigfile is empty, msgfile.sig is used. Signatures made with
+// keys revoked by one of the revocation lists are rejected.
+func Verify(pubkeyfile, msgfile, sigfile string, revocations ...*RevocationList) error {
+	if sigfile == "" {
+		sigfile = msgfile + ".sig"
+	}
+	opts := &verifyopts{
+		pubkeyfiles: []string{pubkeyfile},
+		revocations: revocations,
+		quiet:       true,
+	}
+	return verifysimple(opts, msgfile, sigfile)
+}
+
+// checkrevoked returns an error if the key keynum is revoked by one of the
+// revocation lists in opts.
+func (opts *verifyopts) checkrevoked(keynum [keynumlen]byte) error {
+	now := time.Now()
+	for _, l := range opts.revocations {
+		if err := l.Check(keynum, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadrevlists reads the revocation lists in files, which must be signed by
+// the public key in revoker or, if revoker is empty, by one of the public keys
+// of opts. Allowed signers files and keyrings have no key which is trusted to
+// revoke the others and require revoker.
+func loadrevlists(files []string, revoker string, opts *verifyopts) ([]*RevocationList, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+	var keys []pubkey
+	switch {
+	case revoker != "":
+		keys = make([]pubkey, 1)
+		if err := readpubkeyfile(revoker, &keys[0]); err != nil {
+			return nil, err
+		}
+	case opts.policy != nil:
+		return nil, errors.New("revocation lists with -policy require -revoker")
+	case len(opts.pubkeyfiles) == 0 && opts.keyring != nil:
+		return nil, errors.New("revocation lists with -k require -revoker")
+	default:
+		keys = make([]pubkey, len(opts.pubkeyfiles))
+		for i, pubkeyfile := range opts.pubkeyfiles {
+			if err := readpubkeyfile(pubkeyfile, &keys[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("revocation lists require a public key")
+	}
+	var lists []*RevocationList
+	for _, file := range files {
+		l, err := verifyrevlist(file, keys)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+	return lists, nil
+}
+
+// revoke adds the key in pubkeyfile to the revocation list in listfile, which
+// is created if it does not exist, and signs the list with seckey.
+func revoke(seckey, pubkeyfile, listfile, reason string, t time.Time) error {
+	var pubkey pubkey
+	if err := readpubkeyfile(pubkeyfile, &pubkey); err != nil {
+		return err
+	}
+	if len(reason) > 0xffff {
+		return errors.New("reason too long")
+	}
+	signer, err := newsigner(seckey)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+
+	l := &RevocationList{Keynum: signer.Keynum()}
+	if _, err := os.Stat(listfile); err == nil {
+		_, buf, err := readb64file(listfile)
+		if err != nil {
+			return err
+		}
+		if l, _, err = parserevlist(buf); err != nil {
+			return err
+		}
+		if l.Keynum != signer.Keynum() {
+			return fmt.Errorf("revocation list %s signed by another key", listfile)
+		}
+	}
+	for _, e := range l.Entries {
+		if e.Keynum == pubkey.Keynum {
+			return fmt.Errorf("key %s already revoked", pubkeyfile)
+		}
+	}
+	l.Entries = append(l.Entries, Revocation{Keynum: pubkey.Keynum, Time: t, Reason: reason})
+	l.Issued = time.Now()
+
+	s, err := signer.Sign(revlistmsg(l))
+	if err != nil {
+		return err
+	}
+	hdr := revlist{Keynum: l.Keynum, Issued: l.Issued.Unix()}
+	copy(hdr.Pkalg[:], []byte(revlistalg))
+	copy(hdr.Sig[:], s)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, &hdr); err != nil {
+		return err
+	}
+	for _, e := range l.Entries {
+		binary.Write(&buf, binary.BigEndian, &revoked{Keynum: e.Keynum, Time: e.Time.Unix()})
+		writestring(&buf, e.Reason)
+	}
+	comment := fmt.Sprintf("revocation list of %d keys", len(l.Entries))
+	return writeb64file(listfile, comment, buf.Bytes(), nil, os.O_TRUNC, 0666)
+}
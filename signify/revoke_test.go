@@ -0,0 +1,155 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRevoke(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	rootpub := filepath.Join(tmpdir, "root.pub")
+	rootsec := filepath.Join(tmpdir, "root.sec")
+	leakedpub := filepath.Join(tmpdir, "leaked.pub")
+	leakedsec := filepath.Join(tmpdir, "leaked.sec")
+	subpub := filepath.Join(tmpdir, "sub.pub")
+	subsec := filepath.Join(tmpdir, "sub.sec")
+	certfile := filepath.Join(tmpdir, "sub.cert")
+	list := filepath.Join(tmpdir, "revoked.list")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	for _, k := range [][2]string{{rootpub, rootsec}, {leakedpub, leakedsec}, {subpub, subsec}} {
+		if err := Main("signify", "-G", "-n", "-p", k[0], "-s", k[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", leakedsec, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-revoke", "-reason", "key leaked", "-s", rootsec, "-p", leakedpub,
+		"-x", list); err != nil {
+		t.Fatal(err)
+	}
+	err = Main("signify", "-V", "-q", "-revoked", list, "-p", leakedpub, "-m", msgfile)
+	// list is not signed by the leaked key
+	if err == nil || !strings.Contains(err.Error(), "not signed by a trusted key") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// library
+	l, err := ReadRevocationList(list, rootpub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(leakedpub, msgfile, ""); err != nil {
+		t.Fatal(err)
+	}
+	err = Verify(leakedpub, msgfile, "", l)
+	if _, ok := err.(*RevokedError); !ok || !strings.Contains(err.Error(), "key leaked") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := ReadRevocationList(list, leakedpub); err == nil {
+		t.Error("should fail")
+	}
+
+	// certified subkey
+	if err := Main("signify", "-certify", "-expire", "2999-01-01", "-s", rootsec, "-p", subpub,
+		"-x", certfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-cert", certfile, "-s", subsec, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", list, "-p", rootpub, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// extend the list
+	if err := Main("signify", "-revoke", "-reason", "retired", "-s", rootsec, "-p", subpub,
+		"-x", list); err != nil {
+		t.Fatal(err)
+	}
+	err = Main("signify", "-V", "-q", "-revoked", list, "-p", rootpub, "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "retired") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// cannot revoke twice or extend with another key
+	if err := Main("signify", "-revoke", "-s", rootsec, "-p", subpub, "-x", list); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-revoke", "-s", leakedsec, "-p", rootpub, "-x", list); err == nil {
+		t.Error("should fail")
+	}
+	// revocation in the future
+	future := filepath.Join(tmpdir, "future.list")
+	if err := Main("signify", "-revoke", "-start", "2999-01-01", "-s", rootsec, "-p", subpub,
+		"-x", future); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", future, "-p", rootpub, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRevokeChain(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	var pubkeys, seckeys []string
+	for _, name := range []string{"root", "leaked", "attacker"} {
+		pubkeys = append(pubkeys, filepath.Join(tmpdir, name+".pub"))
+		seckeys = append(seckeys, filepath.Join(tmpdir, name+".sec"))
+		if err := Main("signify", "-G", "-n", "-p", pubkeys[len(pubkeys)-1], "-s", seckeys[len(seckeys)-1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t01 := filepath.Join(tmpdir, "root-leaked.transition")
+	t12 := filepath.Join(tmpdir, "leaked-attacker.transition")
+	list := filepath.Join(tmpdir, "revoked.list")
+	old := filepath.Join(tmpdir, "old.list")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-transition", "-start", "2020-01-01", "-s", seckeys[0],
+		"-p", pubkeys[1], "-x", t01); err != nil {
+		t.Fatal(err)
+	}
+	// the holder of the leaked key endorses their own key
+	if err := Main("signify", "-transition", "-start", "2022-01-01", "-s", seckeys[1],
+		"-p", pubkeys[2], "-x", t12); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", seckeys[2], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-chain", t01, "-chain", t12, "-p", pubkeys[0], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-revoke", "-reason", "key leaked", "-start", "2021-01-01",
+		"-s", seckeys[0], "-p", pubkeys[1], "-x", list); err != nil {
+		t.Fatal(err)
+	}
+	err = Main("signify", "-V", "-q", "-revoked", list, "-chain", t01, "-chain", t12,
+		"-p", pubkeys[0], "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "key leaked") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// statements can be backdated, so the time of the revocation does not matter
+	if err := Main("signify", "-revoke", "-reason", "retired", "-start", "2023-01-01",
+		"-s", seckeys[0], "-p", pubkeys[1], "-x", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-revoked", old, "-chain", t01, "-chain", t12,
+		"-p", pubkeys[0], "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
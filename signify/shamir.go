@@ -0,0 +1,211 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/shamir"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+const (
+	sharealg  = "SS" // Shamir share of a secret key
+	seedbytes = ed25519.SeedSize
+	maxshares = 255
+)
+
+// sharekey is the header of a share file. It is followed by the share of the
+// seed of the secret key, which is encrypted like a FROST secret file.
+type sharekey struct {
+	Pkalg     [2]byte
+	Kdfalg    [2]byte
+	Kdfrounds [4]byte
+	Salt      [16]byte
+	Checksum  [8]byte
+	Keynum    [keynumlen]byte // of the split key
+	Index     uint16          // of the share, from 1 to Shares
+	Threshold uint16          // number of shares required to recover the key
+	Shares    uint16          // number of shares the key was split into
+	Pubkey    [publicbytes]byte
+}
+
+// sharefile returns the name of the share with the given index.
+func sharefile(prefix string, index int) string {
+	return fmt.Sprintf("%s.%d", prefix, index)
+}
+
+// split splits the secret key seckeyfile into n shares with the given
+// threshold k, written to prefix.1 to prefix.n. Every share is protected with
+// its own passphrase unless rounds is zero.
+func split(seckeyfile, prefix string, k, n, rounds int) error {
+	var enckey enckey
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	if k < 2 || k > n || n > maxshares {
+		return errors.New("invalid threshold or number of shares")
+	}
+	if _, err := readseckey(seckeyfile, &enckey); err != nil {
+		return err
+	}
+	shares, err := shamir.Split(enckey.Seckey[:seedbytes], n, k, rand.Reader)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, s := range shares {
+			util.BzeroBytes(s.Data)
+		}
+	}()
+	for _, s := range shares {
+		key := sharekey{
+			Keynum:    enckey.Keynum,
+			Index:     uint16(s.Index),
+			Threshold: uint16(k),
+			Shares:    uint16(n),
+		}
+		copy(key.Pkalg[:], []byte(sharealg))
+		copy(key.Kdfalg[:], []byte(kdfalg))
+		binary.BigEndian.PutUint32(key.Kdfrounds[:], uint32(rounds))
+		copy(key.Pubkey[:], enckey.Seckey[publicbytes:])
+		filename := sharefile(prefix, int(s.Index))
+		var pass []byte
+		if rounds > 0 {
+			pass, err = readpassphrase(fmt.Sprintf("passphrase for %s", filename), true)
+			if err != nil {
+				return err
+			}
+		}
+		comment := fmt.Sprintf("secret key share %d of %d (threshold %d) of key %x",
+			s.Index, n, k, enckey.Keynum)
+		err = writeshare(filename, comment, &key, s.Data, pass, rounds)
+		util.BzeroBytes(pass) // wipe early, wipe often
+		util.MunlockBytes(pass)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeshare encrypts the share data with pass and writes it with the header
+// key to filename.
+func writeshare(filename, comment string, key *sharekey, data, pass []byte, rounds int) error {
+	enc, err := sealsecret(key.Salt[:], key.Checksum[:], data, pass, rounds)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(enc)
+	defer util.BzeroBytes(enc)
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.BigEndian, key); err != nil {
+		return err
+	}
+	buf.Write(enc)
+	defer util.BzeroBytes(buf.Bytes())
+	return writeb64file(filename, comment, buf.Bytes(), nil, os.O_EXCL, 0600)
+}
+
+// readshare reads and decrypts the secret key share in filename.
+func readshare(filename string, key *sharekey) (*shamir.Share, error) {
+	_, buf, err := readb64file(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := bytes.NewReader(buf)
+	if err := binary.Read(r, binary.BigEndian, key); err != nil {
+		return nil, fmt.Errorf("invalid file %s", filename)
+	}
+	if string(key.Pkalg[:]) != sharealg {
+		return nil, fmt.Errorf("unexpected file type in %s", filename)
+	}
+	if string(key.Kdfalg[:]) != kdfalg {
+		return nil, errors.New("unsupported KDF")
+	}
+	secret := buf[len(buf)-r.Len():]
+	if len(secret) != seedbytes || key.Index == 0 || key.Index > key.Shares ||
+		key.Threshold < 2 || key.Threshold > key.Shares || key.Shares > maxshares {
+		return nil, fmt.Errorf("invalid file %s", filename)
+	}
+	var pass []byte
+	if binary.BigEndian.Uint32(key.Kdfrounds[:]) > 0 {
+		pass, err = readpassphrase(fmt.Sprintf("passphrase for %s", filename), false)
+		if err != nil {
+			return nil, err
+		}
+		defer util.MunlockBytes(pass)
+		defer util.BzeroBytes(pass)
+	}
+	rounds := binary.BigEndian.Uint32(key.Kdfrounds[:])
+	if err := opensecret(key.Salt[:], key.Checksum[:], secret, pass, int(rounds)); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return &shamir.Share{Index: byte(key.Index), Data: secret}, nil
+}
+
+// combine recombines the secret key shares in files into the secret key
+// seckeyfile protected as described by opts, after verifying it against the
+// public key pubkeyfile.
+func combine(pubkeyfile, seckeyfile, comment string, files []string, rounds int, opts *protectopts) error {
+	var (
+		pub    pubkey
+		enckey enckey
+		first  sharekey
+		shares []shamir.Share
+	)
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+	defer func() {
+		for _, s := range shares {
+			util.BzeroBytes(s.Data)
+		}
+	}()
+
+	if err := readpubkeyfile(pubkeyfile, &pub); err != nil {
+		return err
+	}
+	for i, filename := range files {
+		var key sharekey
+		s, err := readshare(filename, &key)
+		if err != nil {
+			return err
+		}
+		shares = append(shares, *s)
+		if i == 0 {
+			first = key
+		} else if key.Keynum != first.Keynum || key.Threshold != first.Threshold ||
+			key.Shares != first.Shares || key.Pubkey != first.Pubkey {
+			return fmt.Errorf("%s belongs to another split", filename)
+		}
+	}
+	if len(shares) < int(first.Threshold) {
+		return fmt.Errorf("need %d shares", first.Threshold)
+	}
+	if first.Keynum != pub.Keynum || first.Pubkey != pub.Pubkey {
+		return fmt.Errorf("shares do not belong to %s", pubkeyfile)
+	}
+	seed, err := shamir.Combine(shares)
+	if err != nil {
+		return err
+	}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	util.BzeroBytes(seed) // wipe early, wipe often
+	copy(enckey.Seckey[:], privateKey)
+	util.BzeroBytes(privateKey) // wipe early, wipe often
+	if !bytes.Equal(enckey.Seckey[publicbytes:], pub.Pubkey[:]) {
+		return fmt.Errorf("recombined key does not match %s", pubkeyfile)
+	}
+	enckey.Keynum = pub.Keynum
+	commentbuf := fmt.Sprintf("%s secret key", comment)
+	if len(commentbuf) >= commentmaxlen {
+		return errors.New("comment too long") // for compatibility
+	}
+	return writeseckey(seckeyfile, commentbuf, &enckey, rounds, opts)
+}
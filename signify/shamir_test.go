@@ -0,0 +1,79 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShamir(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	stdin := os.Stdin // backup stdin
+	defer func() { os.Stdin = stdin }()
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	otherpub := filepath.Join(tmpdir, "other.pub")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	prefix := filepath.Join(tmpdir, "share")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-G", "-n", "-p", otherpub, "-s", filepath.Join(tmpdir, "other.sec")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-split", "-threshold", "4", "-shares", "3", "-s", seckeyfile, "-x", prefix); err == nil {
+		t.Error("should fail")
+	}
+
+	// every share is protected with its own passphrase
+	setstdin(t, tmpdir, "one\none\ntwo\ntwo\nthree\nthree\n")
+	if err := Main("signify", "-split", "-threshold", "2", "-shares", "3", "-s", seckeyfile, "-x", prefix); err != nil {
+		t.Fatal(err)
+	}
+	setstdin(t, tmpdir, "three\none\n")
+	restored := filepath.Join(tmpdir, "restored.sec")
+	if err := Main("signify", "-combine", "-n", "-p", pubkeyfile, "-s", restored,
+		sharefile(prefix, 3), sharefile(prefix, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", restored, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+
+	// too few shares, the wrong public key, and a wrong passphrase
+	if err := Main("signify", "-split", "-n", "-threshold", "3", "-shares", "5", "-s", seckeyfile, "-x", prefix+"n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-combine", "-n", "-p", pubkeyfile, "-s", filepath.Join(tmpdir, "x.sec"),
+		sharefile(prefix+"n", 2), sharefile(prefix+"n", 5)); err == nil {
+		t.Error("should fail")
+	}
+	if err := Main("signify", "-combine", "-n", "-p", otherpub, "-s", filepath.Join(tmpdir, "x.sec"),
+		sharefile(prefix+"n", 1), sharefile(prefix+"n", 2), sharefile(prefix+"n", 4)); err == nil {
+		t.Error("should fail")
+	}
+	setstdin(t, tmpdir, "one\n")
+	if err := Main("signify", "-combine", "-n", "-p", pubkeyfile, "-s", filepath.Join(tmpdir, "x.sec"),
+		sharefile(prefix+"n", 2), sharefile(prefix, 1), sharefile(prefix+"n", 4)); err == nil {
+		t.Error("should fail")
+	}
+	setstdin(t, tmpdir, "wrong\n")
+	if err := Main("signify", "-combine", "-n", "-p", pubkeyfile, "-s", filepath.Join(tmpdir, "x.sec"),
+		sharefile(prefix, 1), sharefile(prefix, 2)); err == nil {
+		t.Error("should fail")
+	}
+	if _, err := os.Stat(filepath.Join(tmpdir, "x.sec")); !os.IsNotExist(err) {
+		t.Error("secret key should not exist")
+	}
+}
@@ -0,0 +1,77 @@
+package signify
+
+import (
+	"crypto/ed25519"
+	"os"
+	"strings"
+
+	"github.com/frankbraun/gosignify/internal/pkcs11uri"
+	"github.com/frankbraun/gosignify/internal/util"
+)
+
+// signer signs messages with a secret key. All implementations create
+// signatures which are indistinguishable from signatures made with a secret
+// key file.
+type signer interface {
+	// Keynum returns the key number of the secret key.
+	Keynum() [keynumlen]byte
+	// Comment returns the comment of the secret key.
+	Comment() string
+	// Sign signs msg and returns the signature.
+	Sign(msg []byte) ([]byte, error)
+	// Close wipes the secret key and releases all resources.
+	Close() error
+}
+
+// newsigner returns the signer for the secret key denoted by seckey, which is
+// either the name of a secret key file, a PKCS#11 URI, or a plugin URI. If an
+// agent is running, secret key files are not read and the agent is used
+// instead.
+func newsigner(seckey string) (signer, error) {
+	if strings.HasPrefix(seckey, pkcs11uri.Scheme) {
+		return newpkcs11signer(seckey)
+	}
+	if strings.HasPrefix(seckey, pluginscheme) {
+		return newpluginsigner(seckey)
+	}
+	if socket := os.Getenv(agentenv); socket != "" {
+		return newagentsigner(socket, seckey)
+	}
+	return newfilesigner(seckey)
+}
+
+// filesigner signs messages with a decrypted secret key file.
+type filesigner struct {
+	enckey  enckey
+	comment string
+}
+
+func newfilesigner(seckeyfile string) (signer, error) {
+	s := new(filesigner)
+	util.MlockStruct(&s.enckey)
+	comment, err := readseckey(seckeyfile, &s.enckey)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	s.comment = comment
+	return s, nil
+}
+
+func (s *filesigner) Keynum() [keynumlen]byte {
+	return s.enckey.Keynum
+}
+
+func (s *filesigner) Comment() string {
+	return s.comment
+}
+
+func (s *filesigner) Sign(msg []byte) ([]byte, error) {
+	return ed25519.Sign(s.enckey.Seckey[:], msg), nil
+}
+
+func (s *filesigner) Close() error {
+	util.BzeroStruct(&s.enckey)
+	util.MunlockStruct(&s.enckey)
+	return nil
+}
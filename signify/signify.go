@@ -3,6 +3,7 @@ package signify
 import (
 	"bufio"
 	"bytes"
+	"crypto/ecdh"
 	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
@@ -16,9 +17,11 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ebfe/bcrypt_pbkdf"
 	"github.com/frankbraun/gosignify/internal/hash"
+	"github.com/frankbraun/gosignify/internal/pkcs11uri"
 	"github.com/frankbraun/gosignify/internal/util"
 	"golang.org/x/crypto/ssh/terminal"
 )
@@ -58,16 +61,60 @@ type sig struct {
 }
 
 var (
-	argv0 string
-	fs    *flag.FlagSet
+	argv0      string
+	fs         *flag.FlagSet
+	unlockwith string // keyfile to unlock secret keys with instead of $GOSIGNIFY_KEYFILE
 )
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage:")
 	fmt.Fprintf(os.Stderr, "\t%s -C [-q] -p pubkey -x sigfile [file ...]\n", argv0)
-	fmt.Fprintf(os.Stderr, "\t%s -G [-n] [-c comment] -p pubkey -s seckey\n", argv0)
-	fmt.Fprintf(os.Stderr, "\t%s -S [-e] [-x sigfile] -s seckey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -G [-n] [-hybrid] [-c comment] -p pubkey -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -G -argon2id [-n] [-keyfile keyfile] [-kdfmemory MiB] [-kdftime n] [-c comment] -p pubkey -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -G -r recipient ... [-c comment] -p pubkey -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -G -master master -path path [-n] [-argon2id] [-c comment] -p pubkey -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -derived -master master path ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -migrate [-n] [-keyfile keyfile] [-kdfmemory MiB] [-kdftime n] -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -migrate -r recipient ... -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -split [-n] -threshold k -shares n -s seckey -x prefix\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -combine [-n] [-argon2id] [-c comment] -p pubkey -s seckey share ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -mnemonic [-x file] -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -restore [-n] [-argon2id] [-c comment] [-m file] -p pubkey -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -comment -c comment file ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -doctor [-q] [-minrounds n] [-kdfmemory MiB] [-kdftime n] [-p pubkey] [-s seckey] [dir ...]\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -I [-p pubkey] [-s seckey] [-x sigfile]\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -S [-e] [-keyfile keyfile] [-x sigfile] -s seckey -m message\n", argv0)
 	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-x sigfile] -p pubkey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-threshold n] [-x sigfile] -p pubkey -p pubkey ... -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-chain statement ...] [-x sigfile] -p pubkey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -transition [-start time] -s seckey -p newpubkey -x statement\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -certify [-start time] -expire time [-namespace ns] [-pattern pattern] -s seckey -p subpubkey -x cert\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -S -cert cert [-e] [-x sigfile] -s subseckey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-revoked list ...] [-x sigfile] -p pubkey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] -revoked list ... -revoker pubkey [-x sigfile] -policy allowed_signers -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] -revoked list ... -revoker pubkey [-x sigfile] -k keyring -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -revoke [-reason reason] [-start time] -s seckey -p revokedpubkey -x list\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -S -t [-e] [-expire time] [-namespace ns] [-meta key=value ...] [-x sigfile] -s seckey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-namespace ns] [-strict] [-x sigfile] -p pubkey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-namespace ns] [-x sigfile] -policy allowed_signers -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V [-eq] [-x sigfile] -k keyring -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -S -ph [-x sigfile] -s seckey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -K -k keyring add pubkey ... | list | remove keynum ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -K -k keyring -p pubkey export keynum\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -cosign [-e] [-x sigfile] -p pubkey ... -s seckey [-m message]\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -S -cose [-e] [-aad file] [-x sigfile] -s seckey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V -cose [-eq] [-aad file] [-x sigfile] -p pubkey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -S -dsse [-type type] [-x sigfile] -s seckey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -V -dsse [-eq] [-type type] [-x sigfile] -p pubkey -m message\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -agent [-lifetime duration] [-socket path] -s seckey\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -agent -lock | -unlock [-socket path]\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -dkg -round 1 [-n] -id id -threshold t -participants n -s state -x package\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -dkg -round 2 -s state -x package package ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -dkg -round 3 [-c comment] -p pubkey -s state package ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -frost -round 1 -s share -x commitment\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -frost -round 2 -s share -m message -x sigshare commitment ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -frost -round 3 [-e] [-x sigfile] -p pubkey -m message file ...\n", argv0)
+	fmt.Fprintf(os.Stderr, "\t%s -intoto -type type [-predicate file] -m message file ...\n", argv0)
 	fs.PrintDefaults()
 }
 
@@ -106,6 +153,16 @@ func xopen(fname string, oflags, mode int) (*os.File, error) {
 	return fd, nil
 }
 
+// knownalg reports whether alg is a known algorithm of key and signature files.
+func knownalg(alg string) bool {
+	switch alg {
+	case pkalg, phalg, hybridalg, multisigalg, transitionalg, certalg, certsigalg, revlistalg, extsigalg, frostdkgalg, frostsharealg, frostnoncealg,
+		frostround1alg, frostround2alg, frostcommitalg, frostsigalg, sharealg:
+		return true
+	}
+	return false
+}
+
 func parseb64file(filename string, b64 []byte) (string, []byte, []byte, error) {
 	lines := strings.SplitAfterN(string(b64), "\n", 3)
 	if len(lines) < 2 || !strings.HasPrefix(lines[0], commenthdr) {
@@ -124,7 +181,7 @@ func parseb64file(filename string, b64 []byte) (string, []byte, []byte, error) {
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("invalid base64 encoding in %s", filename)
 	}
-	if len(buf) < 2 || string(buf[:2]) != pkalg {
+	if len(buf) < 2 || !knownalg(string(buf[:2])) {
 		return "", nil, nil, fmt.Errorf("unsupported file %s", filename)
 	}
 	var msg []byte
@@ -203,133 +260,227 @@ func writeb64file(filename, comment string, data interface{}, msg []byte, oflags
 	return nil
 }
 
-func kdf(salt []byte, rounds int, confirm bool, key []byte) error {
-	if rounds == 0 {
-		// key is already initialized to zero, not need to do it again
-		return nil
+// readline reads a line from r without reading past its end, so that further
+// passphrases or a message can be read from stdin afterwards.
+func readline(r io.Reader) ([]byte, error) {
+	var b [1]byte
+	line := make([]byte, 0, 256)
+	for {
+		n, err := r.Read(b[:])
+		if n == 1 {
+			line = append(line, b[0])
+			if b[0] == '\n' {
+				return line, nil
+			}
+		}
+		if err != nil {
+			return line, err
+		}
 	}
+}
 
-	// read passphrase from stdin
+// readpassphrase reads a passphrase from stdin after showing prompt. If
+// confirm is true, the passphrase has to be entered twice. The returned passphrase is locked to
+// memory and must be wiped and unlocked by the caller.
+func readpassphrase(prompt string, confirm bool) ([]byte, error) {
 	var (
-		pass   []byte
-		pass2  []byte
-		reader *bufio.Reader
-		err    error
+		pass  []byte
+		pass2 []byte
+		err   error
 	)
 	isTerminal := terminal.IsTerminal(0)
-	fmt.Printf("passphrase: ")
+	fmt.Printf("%s: ", prompt)
 	if isTerminal {
 		pass, err = terminal.ReadPassword(0)
 		fmt.Println("")
 	} else {
-		reader = bufio.NewReader(os.Stdin)
-		pass, err = reader.ReadBytes('\n')
+		pass, err = readline(os.Stdin)
 	}
 	if err != nil {
 		if err == io.EOF {
-			return errors.New("unable to read passphrase")
+			return nil, errors.New("unable to read passphrase")
 		}
-		return err
+		return nil, err
 	}
 	util.MlockBytes(pass)
-	defer util.MunlockBytes(pass)
-	defer util.BzeroBytes(pass)
 
 	if len(pass) == 0 {
-		return errors.New("please provide a password")
+		return nil, errors.New("please provide a password")
 	}
 	pass = bytes.TrimRight(pass, "\n")
 
 	// confirm passphrase, if necessary
 	if confirm {
-		fmt.Printf("confirm passphrase: ")
+		fmt.Printf("confirm %s: ", prompt)
 		if isTerminal {
 			pass2, err = terminal.ReadPassword(0)
 			fmt.Println("")
 		} else {
-			pass2, err = reader.ReadBytes('\n')
+			pass2, err = readline(os.Stdin)
 		}
 		if err != nil {
-			return err
+			util.BzeroBytes(pass)
+			util.MunlockBytes(pass)
+			return nil, err
 		}
 		util.MlockBytes(pass2)
 		defer util.MunlockBytes(pass2)
 		defer util.BzeroBytes(pass2)
 		pass2 = bytes.TrimRight(pass2, "\n")
 		if !bytes.Equal(pass, pass2) {
-			return errors.New("passwords don't match")
+			util.BzeroBytes(pass)
+			util.MunlockBytes(pass)
+			return nil, errors.New("passwords don't match")
 		}
 		util.BzeroBytes(pass2) // wipe early, wipe often
 		runtime.GC()           // remove potential intermediate slice
 	}
 
+	return pass, nil
+}
+
+func kdf(salt []byte, rounds int, confirm bool, key []byte) error {
+	if rounds == 0 {
+		// key is already initialized to zero, not need to do it again
+		return nil
+	}
+
+	// read passphrase from stdin
+	pass, err := readpassphrase("passphrase", confirm)
+	if err != nil {
+		return err
+	}
+	defer util.MunlockBytes(pass)
+	defer util.BzeroBytes(pass)
+
+	kdfpass(pass, salt, rounds, key)
+	return nil
+}
+
+// kdfpass derives key from the passphrase pass.
+func kdfpass(pass, salt []byte, rounds int, key []byte) {
+	if rounds == 0 {
+		// key is already initialized to zero, not need to do it again
+		return
+	}
 	k := bcrypt_pbkdf.Key(pass, salt, rounds, len(key))
 	util.MlockBytes(k)
 	defer util.MunlockBytes(k)
 	defer util.BzeroBytes(k)
 	copy(key, k)
 	runtime.GC() // remove potential intermediate slice
+}
 
-	return nil
+// protectopts describe how secret keys are protected. The zero value denotes
+// the passphrase encryption with bcrypt_pbkdf of signify(1).
+type protectopts struct {
+	argon      *argonparams      // write version 2 secret keys, if not nil
+	recipients []*ecdh.PublicKey // encrypt to X25519 recipients, if any
+	keyfile    string            // require this keyfile in addition to the passphrase, if set
 }
 
-func generate(pubkeyfile, seckeyfile string, rounds int, comment string) error {
-	var (
-		pubkey pubkey
-		enckey enckey
-		xorkey [secretbytes]byte
-		keynum [keynumlen]byte
-	)
-	util.MlockStruct(&enckey)
-	defer util.MunlockStruct(&enckey)
-	defer util.BzeroStruct(&enckey)
+// writeseckey protects the decrypted secret key in enckey as described by
+// opts and writes it to seckeyfile, which must not exist. The secret key is
+// protected with a passphrase unless rounds is zero. enckey is encrypted in
+// place.
+func writeseckey(seckeyfile, comment string, enckey *enckey, rounds int, opts *protectopts) error {
+	var xorkey [secretbytes]byte
 	util.MlockBytes(xorkey[:])
 	defer util.MunlockBytes(xorkey[:])
 	defer util.BzeroBytes(xorkey[:])
 
-	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
-	if err != nil {
-		return err
-	}
-	copy(pubkey.Pubkey[:], publicKey[:])
-	copy(enckey.Seckey[:], privateKey[:])
-	if _, err := io.ReadFull(rand.Reader, keynum[:]); err != nil {
-		return err
-	}
-
-	digest := hash.SHA512(privateKey[:])
+	digest := hash.SHA512(enckey.Seckey[:])
 	util.MlockBytes(digest)
 	defer util.MunlockBytes(digest)
 	defer util.BzeroBytes(digest)
 
+	var (
+		data interface{} = enckey
+		err  error
+	)
 	copy(enckey.Pkalg[:], []byte(pkalg))
 	copy(enckey.Kdfalg[:], []byte(kdfalg))
 	binary.BigEndian.PutUint32(enckey.Kdfrounds[:], uint32(rounds))
-	copy(enckey.Keynum[:], keynum[:])
-	if _, err := io.ReadFull(rand.Reader, enckey.Salt[:]); err != nil {
-		return err
+	if len(opts.recipients) > 0 {
+		if data, err = encryptrecipients(enckey, opts.recipients); err != nil {
+			return err
+		}
+	} else if opts.argon != nil {
+		var pass, keyfile []byte
+		if opts.keyfile != "" {
+			keyfile, err = readkeyfile(opts.keyfile, true)
+			if err != nil {
+				return err
+			}
+			defer util.MunlockBytes(keyfile)
+			defer util.BzeroBytes(keyfile)
+		}
+		if rounds > 0 {
+			pass, err = readpassphrase("passphrase", true)
+			if err != nil {
+				return err
+			}
+			defer util.MunlockBytes(pass)
+			defer util.BzeroBytes(pass)
+		}
+		if data, err = encryptv2(enckey, opts.argon, pass, keyfile); err != nil {
+			return err
+		}
+	} else {
+		if _, err := io.ReadFull(rand.Reader, enckey.Salt[:]); err != nil {
+			return err
+		}
+		if err := kdf(enckey.Salt[:], rounds, true, xorkey[:]); err != nil {
+			return err
+		}
+		copy(enckey.Checksum[:], digest[:])
+		for i := 0; i < len(enckey.Seckey); i++ {
+			enckey.Seckey[i] ^= xorkey[i]
+		}
 	}
-	if err := kdf(enckey.Salt[:], rounds, true, xorkey[:]); err != nil {
+	util.BzeroBytes(digest)    // wipe early, wipe often
+	util.BzeroBytes(xorkey[:]) // wipe early, wipe often
+	return writeb64file(seckeyfile, comment, data, nil, os.O_EXCL, 0600)
+}
+
+// generate generates a new key pair with the secret key protected as
+// described by opts.
+func generate(pubkeyfile, seckeyfile string, rounds int, comment string, opts *protectopts) error {
+	var enckey enckey
+	util.MlockStruct(&enckey)
+	defer util.MunlockStruct(&enckey)
+	defer util.BzeroStruct(&enckey)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
 		return err
 	}
-	copy(enckey.Checksum[:], digest[:])
-	for i := 0; i < len(enckey.Seckey); i++ {
-		enckey.Seckey[i] ^= xorkey[i]
+	copy(enckey.Seckey[:], privateKey[:])
+	util.BzeroBytes(privateKey) // wipe early, wipe often
+	if _, err := io.ReadFull(rand.Reader, enckey.Keynum[:]); err != nil {
+		return err
 	}
-	util.BzeroBytes(digest)    // wipe early, wipe often
-	util.BzeroBytes(xorkey[:]) // wipe early, wipe often
+	return writekeypair(pubkeyfile, seckeyfile, rounds, comment, &enckey, opts)
+}
+
+// writekeypair writes the decrypted secret key in enckey protected as
+// described by opts to seckeyfile and its public key to pubkeyfile. enckey is
+// wiped.
+func writekeypair(pubkeyfile, seckeyfile string, rounds int, comment string, enckey *enckey, opts *protectopts) error {
+	var pubkey pubkey
+	copy(pubkey.Pkalg[:], []byte(pkalg))
+	pubkey.Keynum = enckey.Keynum
+	copy(pubkey.Pubkey[:], enckey.Seckey[publicbytes:])
 
 	commentbuf := fmt.Sprintf("%s secret key", comment)
 	if len(commentbuf) >= commentmaxlen {
 		return errors.New("comment too long") // for compatibility
 	}
-	if err := writeb64file(seckeyfile, commentbuf, &enckey, nil, os.O_EXCL, 0600); err != nil {
+	if err := writeseckey(seckeyfile, commentbuf, enckey, rounds, opts); err != nil {
 		return err
 	}
-	util.BzeroStruct(&enckey) // wipe early, wipe often
+	util.BzeroStruct(enckey) // wipe early, wipe often
 
-	copy(pubkey.Pkalg[:], []byte(pkalg))
-	copy(pubkey.Keynum[:], keynum[:])
 	commentbuf = fmt.Sprintf("%s public key", comment)
 	if len(commentbuf) >= commentmaxlen {
 		return errors.New("comment too long") // for compatibility
@@ -337,36 +488,90 @@ func generate(pubkeyfile, seckeyfile string, rounds int, comment string) error {
 	return writeb64file(pubkeyfile, commentbuf, &pubkey, nil, os.O_EXCL, 0666)
 }
 
-func sign(seckeyfile, msgfile, sigfile string, embedded bool) error {
-	var (
-		sig        sig
-		enckey     enckey
-		xorkey     [secretbytes]byte
-		sigcomment string
-	)
-	util.MlockStruct(&enckey)
-	defer util.MunlockStruct(&enckey)
-	defer util.BzeroStruct(&enckey)
-	util.MlockBytes(xorkey[:])
-	defer util.MunlockBytes(xorkey[:])
-	defer util.BzeroBytes(xorkey[:])
-
+// readenckey reads the still encrypted secret key from seckeyfile.
+func readenckey(seckeyfile string) (string, []byte, error) {
 	comment, buf, err := readb64file(seckeyfile)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &enckey); err != nil {
-		return err
+	if string(buf[:2]) != pkalg {
+		return "", nil, fmt.Errorf("unsupported file %s", seckeyfile)
+	}
+	if len(buf) < 4 {
+		return "", nil, fmt.Errorf("invalid secret key in %s", seckeyfile)
 	}
+	switch string(buf[2:4]) {
+	case kdfalg:
+		if len(buf) != binary.Size(&enckey{}) {
+			return "", nil, fmt.Errorf("invalid secret key in %s", seckeyfile)
+		}
+	case argonalg:
+		if len(buf) != binary.Size(&enckeyv2{}) {
+			return "", nil, fmt.Errorf("invalid secret key in %s", seckeyfile)
+		}
+	case keyfilealg:
+		if len(buf) != binary.Size(&enckeyv2{})+keyfilecheckbytes {
+			return "", nil, fmt.Errorf("invalid secret key in %s", seckeyfile)
+		}
+	case recipientalg:
+		if _, _, err := parserecipientkey(buf); err != nil {
+			return "", nil, fmt.Errorf("invalid secret key in %s", seckeyfile)
+		}
+	default:
+		return "", nil, errors.New("unsupported KDF")
+	}
+	return comment, buf, nil
+}
 
-	if string(enckey.Kdfalg[:]) != kdfalg {
-		return errors.New("unsupported KDF")
+// enckeynum returns the key number of the encrypted secret key in buf.
+func enckeynum(buf []byte) ([keynumlen]byte, error) {
+	if len(buf) >= 4 && string(buf[2:4]) == recipientalg {
+		k, _, err := parserecipientkey(buf)
+		if err != nil {
+			return [keynumlen]byte{}, errors.New("invalid key")
+		}
+		return k.Keynum, nil
 	}
-	rounds := binary.BigEndian.Uint32(enckey.Kdfrounds[:])
+	if len(buf) >= 4 && (string(buf[2:4]) == argonalg || string(buf[2:4]) == keyfilealg) {
+		var k enckeyv2
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &k); err != nil {
+			return [keynumlen]byte{}, errors.New("invalid key")
+		}
+		return k.Keynum, nil
+	}
+	var k enckey
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &k); err != nil {
+		return [keynumlen]byte{}, errors.New("invalid key")
+	}
+	return k.Keynum, nil
+}
 
-	if err := kdf(enckey.Salt[:], int(rounds), false, xorkey[:]); err != nil {
+// decryptseckey decrypts the secret key in buf, as read by readenckey, into
+// enckey with passphrase pass, which is read from stdin if nil. Secret keys
+// encrypted to recipients are decrypted with an identity instead.
+func decryptseckey(buf []byte, enckey *enckey, pass []byte) error {
+	var xorkey [secretbytes]byte
+	util.MlockBytes(xorkey[:])
+	defer util.MunlockBytes(xorkey[:])
+	defer util.BzeroBytes(xorkey[:])
+
+	switch string(buf[2:4]) {
+	case argonalg, keyfilealg:
+		return decryptv2(buf, enckey, pass)
+	case recipientalg:
+		return decryptrecipients(buf, enckey)
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, enckey); err != nil {
 		return err
 	}
+	rounds := binary.BigEndian.Uint32(enckey.Kdfrounds[:])
+	if pass == nil {
+		if err := kdf(enckey.Salt[:], int(rounds), false, xorkey[:]); err != nil {
+			return err
+		}
+	} else {
+		kdfpass(pass, enckey.Salt[:], int(rounds), xorkey[:])
+	}
 	for i := 0; i < len(enckey.Seckey); i++ {
 		enckey.Seckey[i] ^= xorkey[i]
 	}
@@ -378,37 +583,137 @@ func sign(seckeyfile, msgfile, sigfile string, embedded bool) error {
 	if !bytes.Equal(enckey.Checksum[:], digest[:8]) {
 		return errors.New("incorrect passphrase")
 	}
-	util.BzeroBytes(digest) // wipe early, wipe often
+	return nil
+}
 
-	msg, err := readmsg(msgfile)
+// readseckey reads the secret key from seckeyfile into enckey and decrypts it
+// with a passphrase read from stdin. The caller is responsible for locking
+// and wiping enckey.
+func readseckey(seckeyfile string, enckey *enckey) (string, error) {
+	comment, buf, err := readenckey(seckeyfile)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if err := decryptseckey(buf, enckey, nil); err != nil {
+		return "", err
 	}
+	return comment, nil
+}
 
-	copy(sig.Sig[:], ed25519.Sign(enckey.Seckey[:], msg))
-	sig.Keynum = enckey.Keynum
-	util.BzeroStruct(&enckey) // wipe early, wipe often
+// signopts holds the options for creating signature files.
+type signopts struct {
+	certfile string       // certificate of the subkey to include, if any
+	embedded bool         // embed the message after the signature
+	trusted  *trustedopts // create an extended signature, if not nil
+}
 
-	copy(sig.Pkalg[:], []byte(pkalg))
+// makesigcomment returns the comment of a signature made with seckeyfile,
+// whose comment is given.
+func makesigcomment(seckeyfile, comment string) (string, error) {
+	var sigcomment string
 	if strings.HasSuffix(seckeyfile, ".sec") {
 		prefix := strings.TrimSuffix(seckeyfile, ".sec")
 		sigcomment = fmt.Sprintf("%s%s.pub", verifywith, prefix)
-		if len(sigcomment) >= commentmaxlen {
-			return errors.New("comment too long") // for compatibility
-		}
 	} else {
 		sigcomment = fmt.Sprintf("signature from %s", comment)
-		if len(sigcomment) >= commentmaxlen {
-			return errors.New("comment too long") // for compatibility
+	}
+	if len(sigcomment) >= commentmaxlen {
+		return "", errors.New("comment too long") // for compatibility
+	}
+	return sigcomment, nil
+}
+
+func sign(seckeyfile, msgfile, sigfile string, opts *signopts) error {
+	var (
+		sig        sig
+		sigcomment string
+		data       interface{}
+	)
+
+	if opts.certfile != "" && opts.trusted != nil {
+		return errors.New("signatures of subkeys cannot carry a trusted block")
+	}
+	if ishybrid(seckeyfile) {
+		if opts.certfile != "" || opts.trusted != nil {
+			return errors.New("hybrid keys only create plain signatures")
 		}
+		return signhybrid(seckeyfile, msgfile, sigfile, opts.embedded)
 	}
+	signer, err := newsigner(seckeyfile)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
 
-	if embedded {
-		if err := writeb64file(sigfile, sigcomment, &sig, msg, os.O_TRUNC, 0666); err != nil {
+	// bind the signature to its namespace, if any
+	var head []byte
+	if opts.trusted != nil {
+		head = namespacehead(opts.trusted.namespace)
+	} else if opts.certfile != "" {
+		c, err := readcert(opts.certfile)
+		if err != nil {
+			return err
+		}
+		head = namespacehead(c.namespace)
+	}
+
+	var (
+		msg []byte
+		s   []byte
+	)
+	if ss, ok := signer.(streamsigner); ok && !opts.embedded && regularfile(msgfile) {
+		// sign without reading the message into memory
+		fd, err := os.Open(msgfile)
+		if err != nil {
+			return err
+		}
+		defer fd.Close()
+		if s, err = ss.SignStream(head, fd); err != nil {
+			return err
+		}
+	} else {
+		if msg, err = readmsg(msgfile); err != nil {
+			return err
+		}
+		if s, err = signer.Sign(append(head, msg...)); err != nil {
+			return err
+		}
+	}
+	copy(sig.Pkalg[:], []byte(pkalg))
+	copy(sig.Sig[:], s)
+	sig.Keynum = signer.Keynum()
+	data = &sig
+	if opts.trusted != nil {
+		block, err := trustedblock(opts.trusted, msgfile, time.Now())
+		if err != nil {
+			return err
+		}
+		if data, err = extsign(signer, &sig, block); err != nil {
+			return err
+		}
+	}
+	comment := signer.Comment()
+	signer.Close() // wipe early, wipe often
+
+	sigcomment, err = makesigcomment(seckeyfile, comment)
+	if err != nil {
+		return err
+	}
+
+	if opts.certfile != "" {
+		buf, err := appendcert(&sig, opts.certfile)
+		if err != nil {
+			return err
+		}
+		data = buf
+	}
+
+	if opts.embedded {
+		if err := writeb64file(sigfile, sigcomment, data, msg, os.O_TRUNC, 0666); err != nil {
 			return err
 		}
 	} else {
-		if err := writeb64file(sigfile, sigcomment, &sig, nil, os.O_TRUNC, 0666); err != nil {
+		if err := writeb64file(sigfile, sigcomment, data, nil, os.O_TRUNC, 0666); err != nil {
 			return err
 		}
 	}
@@ -416,11 +721,15 @@ func sign(seckeyfile, msgfile, sigfile string, embedded bool) error {
 	return nil
 }
 
-func verifymsg(pubkey *pubkey, msg []byte, sig *sig, quiet bool) error {
+func verifymsg(pubkey *pubkey, msg *message, sig *sig, quiet bool) error {
 	if !bytes.Equal(pubkey.Keynum[:], sig.Keynum[:]) {
 		return errors.New("verification failed: checked against wrong key")
 	}
-	if !ed25519.Verify(pubkey.Pubkey[:], msg, sig.Sig[:]) {
+	ok, err := msg.verify(pubkey, sig.Sig[:])
+	if err != nil {
+		return err
+	}
+	if !ok {
 		return errors.New("signature verification failed")
 	}
 	if !quiet {
@@ -429,7 +738,10 @@ func verifymsg(pubkey *pubkey, msg []byte, sig *sig, quiet bool) error {
 	return nil
 }
 
-func readpubkey(pubkeyfile, sigcomment string) ([]byte, error) {
+// readpubkey reads the public key in pubkeyfile, or in the file named by the
+// signature comment sigcomment if pubkeyfile is empty, which must be a key of
+// the algorithm alg.
+func readpubkey(pubkeyfile, sigcomment, alg string) ([]byte, error) {
 	safepath := "/etc/signify/" // TODO: make this portable!
 
 	if pubkeyfile == "" {
@@ -450,44 +762,136 @@ func readpubkey(pubkeyfile, sigcomment string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if string(buf[:2]) != alg {
+		return nil, fmt.Errorf("unsupported file %s", pubkeyfile)
+	}
 	return buf, err
 }
 
-func verifysimple(pubkeyfile, msgfile, sigfile string, quiet bool) error {
-	var (
-		sig    sig
-		pubkey pubkey
-	)
+// verifyopts holds the options for verifying signature files.
+type verifyopts struct {
+	pubkeyfiles []string          // public keys to verify with
+	key         *pubkey           // public key to verify with instead of pubkeyfiles
+	policy      *Policy           // allowed signers to verify with instead of public keys
+	keyring     *keyring          // keyring to look up keys in without public keys
+	threshold   int               // number of required signatures (0 means all keys)
+	chain       []string          // key transition statements starting at the public key
+	namespace   string            // namespace the signature must be valid for
+	revocations []*RevocationList // revocation lists to consult
+	strict      bool              // enforce expiry and file name of extended signatures
+	quiet       bool              // suppress informational output
+}
 
-	msg, err := readmsg(msgfile)
+// readkey returns the public key to verify the single signature in buf with.
+func (opts *verifyopts) readkey(sigcomment string, buf []byte) (*pubkey, error) {
+	if opts.key != nil {
+		return opts.key, nil
+	}
+	if len(opts.pubkeyfiles) == 0 && opts.keyring != nil {
+		keynum, err := sigkeynum(buf)
+		if err != nil {
+			return nil, err
+		}
+		return opts.keyring.lookup(keynum)
+	}
+	var pubkey pubkey
+	pkbuf, err := readpubkey(opts.pubkeyfile(), sigcomment, pkalg)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := binary.Read(bytes.NewReader(pkbuf), binary.BigEndian, &pubkey); err != nil {
+		return nil, err
 	}
+	return &pubkey, nil
+}
 
-	sigcomment, buf, err := readb64file(sigfile)
+// pubkeyfile returns the first public key file, if any.
+func (opts *verifyopts) pubkeyfile() string {
+	if len(opts.pubkeyfiles) == 0 {
+		return ""
+	}
+	return opts.pubkeyfiles[0]
+}
+
+// verifysigs verifies msg, named name, against the signature or
+// multi-signature in buf.
+func verifysigs(opts *verifyopts, sigcomment, name string, buf []byte, msg *message) error {
+	if opts.policy != nil {
+		_, err := verifypolicy(opts, name, buf, msg)
+		return err
+	}
+	if len(buf) >= 2 && string(buf[:2]) == certsigalg {
+		if len(opts.pubkeyfiles) > 1 || opts.threshold > 0 {
+			return errors.New("signature of a subkey requires a single public key")
+		}
+		pubkey, err := opts.readkey(sigcomment, buf)
+		if err != nil {
+			return err
+		}
+		return verifycertsig(opts, pubkey, name, buf, msg)
+	}
+	if len(buf) >= 2 && string(buf[:2]) == phalg {
+		return verifyph(opts, sigcomment, buf, msg)
+	}
+	if len(buf) >= 2 && string(buf[:2]) == hybridalg {
+		return verifyhybrid(opts, sigcomment, buf, msg)
+	}
+	if len(buf) >= 2 && string(buf[:2]) == extsigalg {
+		if len(opts.pubkeyfiles) > 1 || opts.threshold > 0 {
+			return errors.New("extended signature requires a single public key")
+		}
+		pubkey, err := opts.readkey(sigcomment, buf)
+		if err != nil {
+			return err
+		}
+		return verifyextsig(opts, pubkey, name, buf, msg)
+	}
+	sigs, err := parsesigs(buf)
 	if err != nil {
 		return err
 	}
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &sig); err != nil {
+	if opts.namespace != "" {
+		return fmt.Errorf("signature not made in namespace %s", opts.namespace)
+	}
+	if string(buf[:2]) == multisigalg || len(opts.pubkeyfiles) > 1 || opts.threshold > 0 {
+		if len(opts.chain) > 0 {
+			return errors.New("key transitions require a single public key")
+		}
+		return verifymulti(opts, msg, sigs)
+	}
+	pubkey, err := opts.readkey(sigcomment, buf)
+	if err != nil {
 		return err
 	}
-	buf, err = readpubkey(pubkeyfile, sigcomment)
+
+	if err := opts.checkrevoked(sigs[0].Keynum); err != nil {
+		return err
+	}
+	if len(opts.chain) > 0 {
+		key, err := chainkey(pubkey, opts.chain, sigs[0].Keynum, opts.revocations)
+		if err != nil {
+			return err
+		}
+		return verifymsg(key, msg, &sigs[0], opts.quiet)
+	}
+	return verifymsg(pubkey, msg, &sigs[0], opts.quiet)
+}
+
+func verifysimple(opts *verifyopts, msgfile, sigfile string) error {
+	msg, err := readmessage(msgfile)
 	if err != nil {
 		return err
 	}
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &pubkey); err != nil {
+
+	sigcomment, buf, err := readb64file(sigfile)
+	if err != nil {
 		return err
 	}
 
-	return verifymsg(&pubkey, msg, &sig, quiet)
+	return verifysigs(opts, sigcomment, msgfile, buf, msg)
 }
 
-func verifyembedded(pubkeyfile, sigfile string, quiet bool) ([]byte, error) {
-	var (
-		sig    sig
-		pubkey pubkey
-	)
-
+func verifyembedded(opts *verifyopts, sigfile string) ([]byte, error) {
 	msg, err := readmsg(sigfile)
 	if err != nil {
 		return nil, err
@@ -497,23 +901,13 @@ func verifyembedded(pubkeyfile, sigfile string, quiet bool) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &sig); err != nil {
-		return nil, err
-	}
-	buf, err = readpubkey(pubkeyfile, sigcomment)
-	if err != nil {
-		return nil, err
-	}
-	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &pubkey); err != nil {
-		return nil, err
-	}
 
-	return msg, verifymsg(&pubkey, msg, &sig, quiet)
+	return msg, verifysigs(opts, sigcomment, msgname(sigfile), buf, &message{buf: msg})
 }
 
-func verify(pubkeyfile, msgfile, sigfile string, embedded, quiet bool) error {
+func verify(opts *verifyopts, msgfile, sigfile string, embedded bool) error {
 	if embedded {
-		msg, err := verifyembedded(pubkeyfile, sigfile, quiet)
+		msg, err := verifyembedded(opts, sigfile)
 		if err != nil {
 			return err
 		}
@@ -527,7 +921,7 @@ func verify(pubkeyfile, msgfile, sigfile string, embedded, quiet bool) error {
 		}
 		return nil
 	}
-	return verifysimple(pubkeyfile, msgfile, sigfile, quiet)
+	return verifysimple(opts, msgfile, sigfile)
 }
 
 type checksum struct {
@@ -658,12 +1052,32 @@ func verifychecksums(msg []byte, args []string, quiet bool) error {
 	return nil
 }
 
-func check(pubkeyfile, sigfile string, args []string, quiet bool) error {
-	msg, err := verifyembedded(pubkeyfile, sigfile, quiet)
+func check(opts *verifyopts, sigfile string, args []string) error {
+	msg, err := verifyembedded(opts, sigfile)
 	if err != nil {
 		return err
 	}
-	return verifychecksums(msg, args, quiet)
+	return verifychecksums(msg, args, opts.quiet)
+}
+
+// stringsFlag is a flag which can be given multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// first returns the first value of the flag, if any.
+func (s stringsFlag) first() string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
 }
 
 // Main calls the signify tool with the given args. args[0] is mandatory and
@@ -676,6 +1090,24 @@ func Main(args ...string) error {
 		GENERATE
 		SIGN
 		VERIFY
+		STATEMENT
+		AGENT
+		COSIGN
+		DKG
+		FROST
+		TRANSITION
+		CERTIFY
+		REVOKE
+		KEYRING
+		INSPECT
+		MIGRATE
+		SPLIT
+		COMBINE
+		MNEMONIC
+		RESTORE
+		DERIVED
+		DOCTOR
+		COMMENT
 	)
 	verb := NONE
 	rounds := 42
@@ -685,59 +1117,380 @@ func Main(args ...string) error {
 	}
 
 	argv0 = args[0]
+	unlockwith = ""
 	fs = flag.NewFlagSet(argv0, flag.ContinueOnError)
 	fs.Usage = usage
 	CFlag := fs.Bool("C", false, "Verify a signed checksum list, and then verify the checksum for each file. If no files are specified, all of them are checked. sigfile should be the signed output of sha256(1).")
 	GFlag := fs.Bool("G", false, "Generate a new key pair.")
+	IFlag := fs.Bool("I", false, "Inspect the specified keys or signature and print their algorithm and key number.")
 	SFlag := fs.Bool("S", false, "Sign the specified message file and create a signature.")
 	VFlag := fs.Bool("V", false, "Verify the message and signature match.")
-	comment := fs.String("c", "signify", "Specify the comment to be added during key generation.")
+	KFlag := fs.Bool("K", false, "Run the keyring command given as argument: add pubkey ..., list, remove keynum ..., or export keynum (to pubkey).")
+	agentFlag := fs.Bool("agent", false, "Unlock the secret key and serve sign requests for it on a unix domain socket. With -lock or -unlock, lock or unlock a running agent.")
+	dkgFlag := fs.Bool("dkg", false, "Run the given -round of the distributed key generation of a FROST threshold key.")
+	frostFlag := fs.Bool("frost", false, "Run the given -round of FROST threshold signing: 1 creates a signing commitment, 2 a signature share, and 3 combines them into a signature.")
+	revokeFlag := fs.Bool("revoke", false, "Add the key pubkey to the revocation list sigfile, which is created if necessary, and sign the list with seckey.")
+	transitionFlag := fs.Bool("transition", false, "Sign a statement with seckey that the key in pubkey is its successor.")
+	certifyFlag := fs.Bool("certify", false, "Sign a certificate with the master key seckey which allows the subkey pubkey to sign until -expire, optionally restricted to a -namespace and file names matching a -pattern.")
+	migrateFlag := fs.Bool("migrate", false, "Re-encrypt the secret key seckey in place in the version 2 format with Argon2id and XChaCha20-Poly1305. The current and a new passphrase are read.")
+	splitFlag := fs.Bool("split", false, "Split the secret key seckey into -shares shares written to sigfile.1, sigfile.2, and so on, any -threshold of which recover the key. Every share is protected with its own passphrase unless -n is given.")
+	combineFlag := fs.Bool("combine", false, "Recombine the given shares created with -split into the new secret key seckey, which must match pubkey.")
+	mnemonicFlag := fs.Bool("mnemonic", false, "Write the seed and key number of the secret key seckey as a list of 30 words with a checksum (BIP 39) to sigfile, or to stdout.")
+	restoreFlag := fs.Bool("restore", false, "Restore the secret key seckey, which must match pubkey, from a list of words created with -mnemonic, read from message or stdin.")
+	derivedFlag := fs.Bool("derived", false, "Print the derivation path, key number and public key of the keys derived from the -master secret key for the given paths.")
+	commentFlag := fs.Bool("comment", false, "Replace the untrusted comment of the given public key, secret key or signature files with the -c comment. The rest of the files is kept unchanged and no passphrase is required.")
+	doctorFlag := fs.Bool("doctor", false, "Check that seckey matches pubkey, the permissions, owners and comments of both files, the KDF strength of seckey, and that the signatures (*.sig) in the given directories verify.")
+	intotoFlag := fs.Bool("intoto", false, "Create an in-toto statement about the given files and write it to message.")
+	aadfile := fs.String("aad", "", "With -cose, the file containing external additional authenticated data.")
+	cosignFlag := fs.Bool("cosign", false, "Add a signature made with seckey to the existing signature file sigfile, creating a multi-signature. The existing signature must verify with one of the pubkeys. With -e, the message embedded in sigfile is signed.")
+	var chain stringsFlag
+	fs.Var(&chain, "chain", "When verifying, a key transition statement created with -transition. The first statement must be signed by pubkey, every further one by the key endorsed by the statement before it. The signature can be made by any key of the chain.")
+	certfile := fs.String("cert", "", "With -S, the certificate of the subkey seckey, which is included in the signature.")
+	argon2idFlag := fs.Bool("argon2id", false, "With -G, -combine and -restore, write the secret key in the version 2 format, encrypted with XChaCha20-Poly1305 under a key derived with Argon2id.")
+	comment := fs.String("c", "signify", "Specify the comment to be added during key generation. With -comment, the new comment.")
+	coseFlag := fs.Bool("cose", false, "When signing, create a COSE_Sign1 (RFC 9052) message instead of a signature file. The payload is attached with -e and detached otherwise. When verifying, verify a COSE_Sign1 message.")
+	dsseFlag := fs.Bool("dsse", false, "When signing, wrap the message in a DSSE envelope. When verifying, verify a DSSE envelope.")
 	eFlag := fs.Bool("e", false, "When signing, embed the message after the signature. When verifying, extract the message from the signature. (This requires that the signature was created using -e and creates a new message file as output.)")
-	msgfile := fs.String("m", "", "When signing, the file containing the message to sign. When verifying, the file containing the message to verify. When verifying with -e, the file to create.")
+	expire := fs.String("expire", "", "With -certify, the time (YYYY-MM-DD or RFC 3339) at which the certificate expires. With -S, the time at which the signature expires, recorded in the trusted block of an extended signature.")
+	master := fs.String("master", "", "With -G, derive the key pair for -path from this master secret key instead of generating a random one. With -derived, the master secret key.")
+	kdfmemory := fs.Uint("kdfmemory", argonmemory, "With -argon2id and -migrate, the memory used by Argon2id in MiB (at most 4096). With -doctor, the minimum memory of seckey.")
+	kdftime := fs.Uint("kdftime", argontime, "With -argon2id and -migrate, the number of passes of Argon2id (at most 100). With -doctor, the minimum passes of seckey.")
+	id := fs.Int("id", 0, "With -dkg, the identifier of the participant (1 to the number of participants).")
+	var meta stringsFlag
+	fs.Var(&meta, "meta", "With -S, a key=value pair added to the trusted block of an extended signature. Can be given multiple times.")
+	lifetime := fs.Duration("lifetime", 0, "With -agent, the lifetime of the unlocked key, after which the agent exits. The default is forever.")
+	lockFlag := fs.Bool("lock", false, "With -agent, wipe the decrypted secret key from a running agent.")
+	minrounds := fs.Int("minrounds", rounds, "With -doctor, the minimum number of bcrypt_pbkdf rounds of seckey.")
+	msgfile := fs.String("m", "", "When signing, the file containing the message to sign. When verifying, the file containing the message to verify. When verifying with -e, the file to create. With -restore, the file containing the words.")
+	namespace := fs.String("namespace", "", "With -certify, the namespace the subkey is restricted to. With -S, the namespace mixed into the signed message and recorded in the trusted block of an extended signature. When verifying, the namespace the signature must have been made in.")
 	nFlag := fs.Bool("n", false, "Do not ask for a passphrase during key generation. Otherwise, signify will prompt the user for a passphrase to protect the secret key.")
-	pubkey := fs.String("p", "", "Public key produced by -G, and used by -V to check a signature.")
+	path := fs.String("path", "", "With -G and -master, the derivation path of the key pair, like m/1/2026. All indices are hardened.")
+	participants := fs.Int("participants", 0, "With -dkg, the number of participants.")
+	pattern := fs.String("pattern", "", "With -certify, the pattern (see filepath.Match) the base names of files signed by the subkey must match.")
+	predicate := fs.String("predicate", "", "With -intoto, the file containing the JSON predicate of the statement.")
+	var pubkeys stringsFlag
+	fs.Var(&pubkeys, "p", "Public key produced by -G, and used by -V to check a signature. Can be given multiple times to verify a multi-signature.")
+	hybridFlag := fs.Bool("hybrid", false, "With -G, generate a hybrid key pair consisting of an Ed25519 and an ML-DSA-65 (FIPS 204) key pair. Its signatures contain signatures of both keys and only verify if both do.")
+	phFlag := fs.Bool("ph", false, "With -S, create an Ed25519ph signature of the SHA-512 hash of the message, which is computed without reading the message into memory.")
+	policyfile := fs.String("policy", "", "When verifying, an allowed signers file whose entries list principals, public keys, and the namespaces, validity and file names they may sign. Used instead of -p; reports the principal who signed.")
+	keyfile := fs.String("keyfile", "", "With -G, -migrate, -combine and -restore, a keyfile which is required in addition to the passphrase to decrypt the secret key. It is created with random contents if it does not exist. Implies -argon2id. With -S and the other commands using seckey, the keyfile to decrypt it with. The default is taken from $"+keyfileenv+".")
+	var recipients stringsFlag
+	fs.Var(&recipients, "r", "With -G, -migrate, -combine and -restore, encrypt the secret key to the age X25519 recipient (age1...), or to the recipients listed in the given file, instead of protecting it with a passphrase. It is decrypted with an identity from the file $"+identityenv+". Can be given multiple times.")
+	round := fs.Int("round", 0, "With -dkg or -frost, the round to run.")
+	reason := fs.String("reason", "", "With -revoke, the reason for the revocation.")
+	var revlists stringsFlag
+	fs.Var(&revlists, "revoked", "When verifying, a revocation list created with -revoke and signed by pubkey. Signatures made with revoked keys are rejected. Can be given multiple times.")
+	revoker := fs.String("revoker", "", "With -revoked, the public key which signs the revocation lists instead of pubkey. Required with -policy and -k.")
+	keyringpath := fs.String("k", os.Getenv(keyringenv), "The keyring, either a directory or a file. When verifying without pubkey, the key is looked up in it by its key number. The default is taken from $"+keyringenv+".")
 	qFlag := fs.Bool("q", false, "Quiet mode. Suppress informational output.")
-	seckey := fs.String("s", "", "Secret (private) key produced by -G, and used by -S to sign a message.")
-	sigfile := fs.String("x", "", "The signature file to create or verify. The default is message.sig.")
+	shares := fs.Int("shares", 0, "With -split, the number of shares to create.")
+	seckey := fs.String("s", "", "Secret (private) key produced by -G, and used by -S to sign a message. Either a file, a PKCS#11 URI (RFC 7512) denoting an Ed25519 key on a token, or plugin:name:data denoting a key of the signer plugin gosignify-plugin-name.")
+	threshold := fs.Int("threshold", 0, "When verifying a multi-signature, the number of public keys which must have signed. The default is all given keys. With -dkg, the number of participants required to sign. With -split, the number of shares required to recover the secret key.")
+	typ := fs.String("type", "", "With -dsse, the payload type (default application/vnd.in-toto+json for in-toto statements and application/octet-stream otherwise). With -intoto, the predicate type.")
+	strictFlag := fs.Bool("strict", false, "When verifying extended signatures, reject expired signatures and signatures made for another file name instead of warning.")
+	tFlag := fs.Bool("t", false, "With -S, create an extended signature with a signed trusted block containing the time of signing and the file name.")
+	socket := fs.String("socket", "", "With -agent, the unix domain socket of the agent. The default is taken from $"+agentenv+".")
+	unlockFlag := fs.Bool("unlock", false, "With -agent, decrypt the secret key of a locked agent again.")
+	start := fs.String("start", "", "With -transition or -certify, the time (YYYY-MM-DD or RFC 3339) from which on the new key is valid. With -revoke, the time from which on the key is revoked. The default is now.")
+	sigfile := fs.String("x", "", "The signature file to create or verify. The default is message.sig. With -split, the prefix of the share files. With -mnemonic, the file to write the words to.")
 	if err := fs.Parse(args[1:]); err != nil {
 		return err
 	}
+	pubkey := pubkeys.first()
+	opts := &verifyopts{
+		pubkeyfiles: pubkeys,
+		threshold:   *threshold,
+		chain:       chain,
+		namespace:   *namespace,
+		strict:      *strictFlag,
+		quiet:       *qFlag,
+	}
 
-	if *CFlag {
-		verb = CHECK
+	verbs := []struct {
+		set  *bool
+		verb int
+	}{
+		{CFlag, CHECK},
+		{GFlag, GENERATE},
+		{SFlag, SIGN},
+		{VFlag, VERIFY},
+		{intotoFlag, STATEMENT},
+		{agentFlag, AGENT},
+		{cosignFlag, COSIGN},
+		{dkgFlag, DKG},
+		{frostFlag, FROST},
+		{transitionFlag, TRANSITION},
+		{certifyFlag, CERTIFY},
+		{revokeFlag, REVOKE},
+		{KFlag, KEYRING},
+		{IFlag, INSPECT},
+		{migrateFlag, MIGRATE},
+		{splitFlag, SPLIT},
+		{combineFlag, COMBINE},
+		{mnemonicFlag, MNEMONIC},
+		{restoreFlag, RESTORE},
+		{derivedFlag, DERIVED},
+		{doctorFlag, DOCTOR},
+		{commentFlag, COMMENT},
+	}
+	for _, v := range verbs {
+		if *v.set {
+			if verb != NONE {
+				usage()
+				return flag.ErrHelp
+			}
+			verb = v.verb
+		}
+	}
+	if (*coseFlag && *dsseFlag) || (*lockFlag && *unlockFlag) {
+		usage()
+		return flag.ErrHelp
 	}
-	if *GFlag {
-		if verb != NONE {
+	if *nFlag {
+		rounds = 0
+	}
+	if (verb == CHECK || verb == VERIFY) && *policyfile != "" {
+		if len(pubkeys) > 0 || *coseFlag || *dsseFlag {
+			usage()
+			return flag.ErrHelp
+		}
+		policy, err := ReadPolicy(*policyfile)
+		if err != nil {
+			return err
+		}
+		opts.policy = policy
+	}
+	if (verb == CHECK || verb == VERIFY) && *threshold > 0 && len(pubkeys) == 0 {
+		fmt.Fprintln(os.Stderr, "must specify pubkey")
+		usage()
+		return flag.ErrHelp
+	}
+	if (verb == CHECK || verb == VERIFY) && len(pubkeys) == 0 && opts.policy == nil && *keyringpath != "" {
+		r, err := openkeyring(*keyringpath)
+		if err != nil {
+			return err
+		}
+		opts.keyring = r
+	}
+	if (verb == CHECK || verb == VERIFY) && len(revlists) > 0 {
+		lists, err := loadrevlists(revlists, *revoker, opts)
+		if err != nil {
+			return err
+		}
+		opts.revocations = lists
+	}
+
+	if verb == CHECK {
+		if *sigfile == "" {
+			fmt.Fprintln(os.Stderr, "must specify sigfile")
 			usage()
 			return flag.ErrHelp
 		}
-		verb = GENERATE
+		return check(opts, *sigfile, fs.Args())
 	}
-	if *SFlag {
-		if verb != NONE {
+
+	if verb == KEYRING {
+		if *keyringpath == "" {
+			fmt.Fprintln(os.Stderr, "must specify keyring")
 			usage()
 			return flag.ErrHelp
 		}
-		verb = SIGN
+		r, err := openkeyring(*keyringpath)
+		if err != nil {
+			return err
+		}
+		return keyringcmd(r, pubkey, fs.Args())
 	}
-	if *VFlag {
-		if verb != NONE {
+
+	if verb == INSPECT {
+		if fs.NArg() != 0 || (pubkey == "" && *seckey == "" && *sigfile == "") {
 			usage()
 			return flag.ErrHelp
 		}
-		verb = VERIFY
+		return inspect(pubkey, *seckey, *sigfile)
 	}
-	if *nFlag {
-		rounds = 0
+
+	if verb == SPLIT {
+		if *seckey == "" || *sigfile == "" || *threshold == 0 || *shares == 0 || fs.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "must specify seckey, sigfile, threshold and shares")
+			usage()
+			return flag.ErrHelp
+		}
+		return split(*seckey, *sigfile, *threshold, *shares, rounds)
 	}
 
-	if verb == CHECK {
+	if verb == MNEMONIC {
+		if *seckey == "" || fs.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "must specify seckey")
+			usage()
+			return flag.ErrHelp
+		}
 		if *sigfile == "" {
-			fmt.Fprintln(os.Stderr, "must specify sigfile")
+			*sigfile = "-"
+		}
+		return exportmnemonic(*seckey, *sigfile)
+	}
+
+	if verb == COMMENT {
+		cFlag := false
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "c" {
+				cFlag = true
+			}
+		})
+		if !cFlag || fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "must specify comment and files")
+			usage()
+			return flag.ErrHelp
+		}
+		for _, filename := range fs.Args() {
+			if err := setcomment(filename, *comment); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if verb == DOCTOR {
+		if fs.NArg() > 0 && pubkey == "" && *keyringpath != "" {
+			r, err := openkeyring(*keyringpath)
+			if err != nil {
+				return err
+			}
+			opts.keyring = r
+		}
+		if (pubkey == "" && *seckey == "" && fs.NArg() == 0) ||
+			(fs.NArg() > 0 && pubkey == "" && opts.keyring == nil) {
+			fmt.Fprintln(os.Stderr, "must specify pubkey, seckey or directories and pubkey")
 			usage()
 			return flag.ErrHelp
 		}
-		return check(*pubkey, *sigfile, fs.Args(), *qFlag)
+		policy := &doctorpolicy{rounds: *minrounds, time: uint64(*kdftime), memory: uint64(*kdfmemory)}
+		opts.quiet = true
+		if err := checkup(pubkey, *seckey, policy, fs.Args(), opts); err != nil {
+			return err
+		}
+		if !*qFlag {
+			fmt.Println("no problems found")
+		}
+		return nil
+	}
+
+	if verb == DERIVED {
+		if *master == "" || fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "must specify master and paths")
+			usage()
+			return flag.ErrHelp
+		}
+		return listderived(*master, fs.Args())
+	}
+	if (*master != "" || *path != "") && (verb != GENERATE || *master == "" || *path == "" || *hybridFlag) {
+		usage()
+		return flag.ErrHelp
+	}
+
+	protect := &protectopts{}
+	if *keyfile != "" {
+		switch verb {
+		case GENERATE, MIGRATE, COMBINE, RESTORE:
+			if *nFlag || len(recipients) > 0 {
+				fmt.Fprintln(os.Stderr, "keyfile requires a passphrase")
+				usage()
+				return flag.ErrHelp
+			}
+			protect.keyfile = *keyfile
+			*argon2idFlag = true
+		case SIGN, AGENT, COSIGN, TRANSITION, CERTIFY, REVOKE, SPLIT, MNEMONIC, DERIVED, DOCTOR:
+			unlockwith = *keyfile
+		default:
+			usage()
+			return flag.ErrHelp
+		}
+	}
+	if *argon2idFlag || verb == MIGRATE {
+		if *kdfmemory == 0 || *kdfmemory > argonmaxmem || *kdftime == 0 || *kdftime > argonmaxtime {
+			fmt.Fprintln(os.Stderr, "invalid KDF parameters")
+			usage()
+			return flag.ErrHelp
+		}
+		protect.argon = &argonparams{time: uint32(*kdftime), memory: uint32(*kdfmemory)}
+	}
+	if len(recipients) > 0 {
+		if *argon2idFlag {
+			usage()
+			return flag.ErrHelp
+		}
+		keys, err := readrecipients(recipients)
+		if err != nil {
+			return err
+		}
+		protect.recipients = keys
+	}
+
+	if verb == MIGRATE {
+		if *seckey == "" || fs.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "must specify seckey")
+			usage()
+			return flag.ErrHelp
+		}
+		return migrate(*seckey, protect, !*nFlag)
+	}
+
+	if verb == COMBINE {
+		if pubkey == "" || *seckey == "" || fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "must specify pubkey, seckey and shares")
+			usage()
+			return flag.ErrHelp
+		}
+		return combine(pubkey, *seckey, *comment, fs.Args(), rounds, protect)
+	}
+
+	if verb == RESTORE {
+		if pubkey == "" || *seckey == "" || fs.NArg() != 0 {
+			fmt.Fprintln(os.Stderr, "must specify pubkey and seckey")
+			usage()
+			return flag.ErrHelp
+		}
+		return restoremnemonic(pubkey, *seckey, *msgfile, *comment, rounds, protect)
+	}
+
+	if verb == STATEMENT {
+		if *msgfile == "" || *typ == "" {
+			fmt.Fprintln(os.Stderr, "must specify message and predicate type")
+			usage()
+			return flag.ErrHelp
+		}
+		return statement(*msgfile, *typ, *predicate, fs.Args())
+	}
+
+	if verb == DKG {
+		switch {
+		case *seckey == "":
+		case *round == 1 && *sigfile != "" && *id > 0 && *threshold > 0 && *participants > 0:
+			return dkground1(*seckey, *sigfile, *id, *threshold, *participants, rounds)
+		case *round == 2 && *sigfile != "":
+			return dkground2(*seckey, *sigfile, fs.Args())
+		case *round == 3 && pubkey != "":
+			return dkground3(pubkey, *seckey, *comment, fs.Args())
+		}
+		usage()
+		return flag.ErrHelp
+	}
+
+	if verb == FROST {
+		switch {
+		case *round == 1 && *seckey != "" && *sigfile != "":
+			return frostcommitment(*seckey, *sigfile)
+		case *round == 2 && *seckey != "" && *msgfile != "" && *sigfile != "":
+			return frostsign(*seckey, *msgfile, *sigfile, fs.Args())
+		case *round == 3 && pubkey != "" && *msgfile != "" && *msgfile != "-":
+			if *sigfile == "" {
+				*sigfile = fmt.Sprintf("%s.sig", *msgfile)
+			}
+			return frostaggregate(pubkey, *msgfile, *sigfile, *eFlag, fs.Args())
+		}
+		usage()
+		return flag.ErrHelp
 	}
 
 	if fs.NArg() != 0 {
@@ -751,26 +1504,171 @@ func Main(args ...string) error {
 			usage()
 			return flag.ErrHelp
 		}
-		*sigfile = fmt.Sprintf("%s.sig", *msgfile)
+		if *coseFlag {
+			*sigfile = fmt.Sprintf("%s.cose", *msgfile)
+		} else if *dsseFlag {
+			*sigfile = fmt.Sprintf("%s.dsse", *msgfile)
+		} else {
+			*sigfile = fmt.Sprintf("%s.sig", *msgfile)
+		}
 	}
 
 	switch verb {
+	case AGENT:
+		if *lockFlag || *unlockFlag {
+			if *socket == "" {
+				*socket = os.Getenv(agentenv)
+			}
+			if *socket == "" {
+				fmt.Fprintln(os.Stderr, "must specify agent socket")
+				usage()
+				return flag.ErrHelp
+			}
+			if *lockFlag {
+				return agentlock(*socket)
+			}
+			return agentunlock(*socket)
+		}
+		if *seckey == "" {
+			fmt.Fprintln(os.Stderr, "must specify seckey")
+			usage()
+			return flag.ErrHelp
+		}
+		if err := runagent(*seckey, *socket, *lifetime); err != nil {
+			return err
+		}
 	case GENERATE:
-		if *pubkey == "" || *seckey == "" {
+		if pubkey == "" || *seckey == "" {
 			fmt.Fprintln(os.Stderr, "must specify pubkey and seckey")
 			usage()
 			return flag.ErrHelp
 		}
-		if err := generate(*pubkey, *seckey, rounds, *comment); err != nil {
-			return err
+		if *master != "" {
+			if err := generatederived(*master, *path, pubkey, *seckey, rounds, *comment, protect); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(*seckey, pkcs11uri.Scheme) {
+			if err := generatepkcs11(pubkey, *seckey, *comment); err != nil {
+				return err
+			}
+		} else if strings.HasPrefix(*seckey, pluginscheme) {
+			if err := generateplugin(pubkey, *seckey, *comment); err != nil {
+				return err
+			}
+		} else if *hybridFlag {
+			if *argon2idFlag || len(recipients) > 0 {
+				fmt.Fprintln(os.Stderr, "hybrid keys do not support -argon2id and -r")
+				usage()
+				return flag.ErrHelp
+			}
+			if err := generatehybrid(pubkey, *seckey, rounds, *comment); err != nil {
+				return err
+			}
+		} else {
+			if err := generate(pubkey, *seckey, rounds, *comment, protect); err != nil {
+				return err
+			}
 		}
 	case SIGN:
-		if *msgfile == "" || *seckey == "" {
+		if *msgfile == "" || (*seckey == "" && os.Getenv(agentenv) == "") {
 			fmt.Fprintln(os.Stderr, "must specify message and seckey")
 			usage()
 			return flag.ErrHelp
 		}
-		if err := sign(*seckey, *msgfile, *sigfile, *eFlag); err != nil {
+		if *coseFlag {
+			if err := signcose(*seckey, *msgfile, *sigfile, *aadfile, *eFlag); err != nil {
+				return err
+			}
+		} else if *dsseFlag {
+			if err := signdsse(*seckey, *msgfile, *sigfile, *typ); err != nil {
+				return err
+			}
+		} else if *phFlag {
+			if *eFlag || *certfile != "" || *tFlag || *expire != "" || *namespace != "" || len(meta) > 0 {
+				fmt.Fprintln(os.Stderr, "prehashed signatures cannot be combined with -e, -cert, -t, -expire, -namespace or -meta")
+				usage()
+				return flag.ErrHelp
+			}
+			if err := signph(*seckey, *msgfile, *sigfile); err != nil {
+				return err
+			}
+		} else {
+			sopts := &signopts{certfile: *certfile, embedded: *eFlag}
+			if *tFlag || *expire != "" || *namespace != "" || len(meta) > 0 {
+				sopts.trusted = &trustedopts{namespace: *namespace, meta: meta}
+				if *expire != "" {
+					t, err := parsetime(*expire)
+					if err != nil {
+						return err
+					}
+					sopts.trusted.expires = t
+				}
+			}
+			if err := sign(*seckey, *msgfile, *sigfile, sopts); err != nil {
+				return err
+			}
+		}
+	case TRANSITION:
+		if *seckey == "" || pubkey == "" || *sigfile == "" {
+			fmt.Fprintln(os.Stderr, "must specify seckey, pubkey and sigfile")
+			usage()
+			return flag.ErrHelp
+		}
+		notbefore := time.Now()
+		if *start != "" {
+			t, err := parsetime(*start)
+			if err != nil {
+				return err
+			}
+			notbefore = t
+		}
+		if err := maketransition(*seckey, pubkey, *sigfile, notbefore); err != nil {
+			return err
+		}
+	case REVOKE:
+		if *seckey == "" || pubkey == "" || *sigfile == "" {
+			fmt.Fprintln(os.Stderr, "must specify seckey, pubkey and sigfile")
+			usage()
+			return flag.ErrHelp
+		}
+		t := time.Now()
+		if *start != "" {
+			var err error
+			if t, err = parsetime(*start); err != nil {
+				return err
+			}
+		}
+		if err := revoke(*seckey, pubkey, *sigfile, *reason, t); err != nil {
+			return err
+		}
+	case CERTIFY:
+		if *seckey == "" || pubkey == "" || *sigfile == "" || *expire == "" {
+			fmt.Fprintln(os.Stderr, "must specify seckey, pubkey, sigfile and expiry")
+			usage()
+			return flag.ErrHelp
+		}
+		notbefore := time.Now()
+		if *start != "" {
+			t, err := parsetime(*start)
+			if err != nil {
+				return err
+			}
+			notbefore = t
+		}
+		notafter, err := parsetime(*expire)
+		if err != nil {
+			return err
+		}
+		if err := certify(*seckey, pubkey, *sigfile, notbefore, notafter, *namespace, *pattern); err != nil {
+			return err
+		}
+	case COSIGN:
+		if *sigfile == "" || *seckey == "" || len(pubkeys) == 0 || (*msgfile == "" && !*eFlag) {
+			fmt.Fprintln(os.Stderr, "must specify sigfile or message, pubkey, and seckey")
+			usage()
+			return flag.ErrHelp
+		}
+		if err := cosign(*seckey, *msgfile, *sigfile, *eFlag, pubkeys); err != nil {
 			return err
 		}
 	case VERIFY:
@@ -779,8 +1677,18 @@ func Main(args ...string) error {
 			usage()
 			return flag.ErrHelp
 		}
-		if err := verify(*pubkey, *msgfile, *sigfile, *eFlag, *qFlag); err != nil {
-			return err
+		if *coseFlag {
+			if err := verifycose(pubkey, *msgfile, *sigfile, *aadfile, *eFlag, *qFlag); err != nil {
+				return err
+			}
+		} else if *dsseFlag {
+			if err := verifydsse(pubkey, *msgfile, *sigfile, *typ, *eFlag, *qFlag); err != nil {
+				return err
+			}
+		} else {
+			if err := verify(opts, *msgfile, *sigfile, *eFlag); err != nil {
+				return err
+			}
 		}
 	default:
 		usage()
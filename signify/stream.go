@@ -0,0 +1,104 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/frankbraun/gosignify/internal/ed25519stream"
+)
+
+// streamsigner is implemented by signers which can sign messages read from
+// a seekable file without keeping them in memory.
+type streamsigner interface {
+	// SignStream signs head followed by the contents of r.
+	SignStream(head []byte, r io.ReadSeeker) ([]byte, error)
+}
+
+func (s *filesigner) SignStream(head []byte, r io.ReadSeeker) ([]byte, error) {
+	return ed25519stream.Sign(s.enckey.Seckey[:], head, r)
+}
+
+// regularfile reports whether filename is a regular file which can be read
+// twice.
+func regularfile(filename string) bool {
+	if filename == "-" {
+		return false
+	}
+	fi, err := os.Stat(filename)
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// message is a message to verify. Messages in regular files are not read
+// into memory, but read from the file whenever they are verified.
+type message struct {
+	head []byte // prepended to the message, for example to bind it to a namespace
+	buf  []byte
+	file string // if not empty, the file containing the message
+}
+
+// readmessage returns the message in msgfile.
+func readmessage(msgfile string) (*message, error) {
+	if regularfile(msgfile) {
+		return &message{file: msgfile}, nil
+	}
+	buf, err := readmsg(msgfile)
+	if err != nil {
+		return nil, err
+	}
+	return &message{buf: buf}, nil
+}
+
+// withhead returns m prefixed with head.
+func (m *message) withhead(head []byte) *message {
+	c := *m
+	c.head = head
+	return &c
+}
+
+func (m *message) open() (io.ReadCloser, error) {
+	if m.file == "" {
+		return ioutil.NopCloser(bytes.NewReader(m.buf)), nil
+	}
+	return os.Open(m.file)
+}
+
+// verify reports whether sig is a valid signature of m by the public key.
+func (m *message) verify(key *pubkey, sig []byte) (bool, error) {
+	if m.file == "" {
+		msg := append(append([]byte{}, m.head...), m.buf...)
+		return ed25519.Verify(key.Pubkey[:], msg, sig), nil
+	}
+	r, err := m.open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return ed25519stream.Verify(key.Pubkey[:], m.head, r, sig)
+}
+
+// bytes returns m without its head, reading it into memory if necessary.
+func (m *message) bytes() ([]byte, error) {
+	if m.file == "" {
+		return m.buf, nil
+	}
+	return ioutil.ReadFile(m.file)
+}
+
+// sha512 returns the SHA-512 hash of m.
+func (m *message) sha512() ([]byte, error) {
+	r, err := m.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	h := sha512.New()
+	h.Write(m.head)
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,69 @@
+package signify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreaming(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	pubkeyfile := filepath.Join(tmpdir, "key.pub")
+	seckeyfile := filepath.Join(tmpdir, "key.sec")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	sigfile := msgfile + ".sig"
+	embedded := filepath.Join(tmpdir, "embedded.sig")
+	if err := Main("signify", "-G", "-n", "-p", pubkeyfile, "-s", seckeyfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// streamed signature of a regular file
+	if err := Main("signify", "-S", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// the embedded message is signed in memory
+	if err := Main("signify", "-S", "-e", "-s", seckeyfile, "-m", msgfile, "-x", embedded); err != nil {
+		t.Fatal(err)
+	}
+	_, streamed, err := readb64file(sigfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, inmemory, err := readb64file(embedded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(streamed) != string(inmemory) {
+		t.Error("streamed signature differs")
+	}
+	msg, err := readmessage(msgfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.file != msgfile || msg.buf != nil {
+		t.Error("regular file read into memory")
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// namespaces are streamed as well
+	if err := Main("signify", "-S", "-namespace", "release", "-s", seckeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-p", pubkeyfile, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(msgfile, []byte("modified\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-namespace", "release", "-p", pubkeyfile, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+}
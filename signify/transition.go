@@ -0,0 +1,162 @@
+package signify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	transitionalg     = "KT"
+	transitioncontext = "gosignify key transition v1\x00"
+)
+
+// transition is a statement signed by an old key which endorses a new key
+// from the time Notbefore (seconds since the epoch) on.
+type transition struct {
+	Pkalg     [2]byte
+	Keynum    [keynumlen]byte // of the old key
+	Sig       [sigbytes]byte
+	Newpkalg  [2]byte
+	Newkeynum [keynumlen]byte
+	Newpubkey [publicbytes]byte
+	Notbefore int64
+}
+
+// transitionmsg returns the signed part of t.
+func transitionmsg(t *transition) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(transitioncontext)
+	buf.Write(t.Newpkalg[:])
+	buf.Write(t.Newkeynum[:])
+	buf.Write(t.Newpubkey[:])
+	binary.Write(&buf, binary.BigEndian, t.Notbefore)
+	return buf.Bytes()
+}
+
+// parsetime parses a time given on the command line, either in RFC 3339
+// format or as a date.
+func parsetime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s (use YYYY-MM-DD or RFC 3339)", s)
+	}
+	return t, nil
+}
+
+// readpubkeyfile reads the public key in pubkeyfile.
+func readpubkeyfile(pubkeyfile string, pubkey *pubkey) error {
+	_, buf, err := readb64file(pubkeyfile)
+	if err != nil {
+		return err
+	}
+	if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, pubkey); err != nil {
+		return err
+	}
+	if string(pubkey.Pkalg[:]) != pkalg {
+		return fmt.Errorf("unsupported file %s", pubkeyfile)
+	}
+	return nil
+}
+
+// maketransition signs a statement with seckey that the key in newpubkeyfile
+// is its successor from notbefore on and writes it to outfile.
+func maketransition(seckey, newpubkeyfile, outfile string, notbefore time.Time) error {
+	var (
+		t      transition
+		pubkey pubkey
+	)
+	if err := readpubkeyfile(newpubkeyfile, &pubkey); err != nil {
+		return err
+	}
+	t.Newpkalg = pubkey.Pkalg
+	t.Newkeynum = pubkey.Keynum
+	t.Newpubkey = pubkey.Pubkey
+	t.Notbefore = notbefore.Unix()
+
+	signer, err := newsigner(seckey)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	if signer.Keynum() == pubkey.Keynum {
+		return errors.New("new key equals old key")
+	}
+	s, err := signer.Sign(transitionmsg(&t))
+	if err != nil {
+		return err
+	}
+	copy(t.Pkalg[:], []byte(transitionalg))
+	t.Keynum = signer.Keynum()
+	copy(t.Sig[:], s)
+
+	comment := fmt.Sprintf("transition to %s", filepath.Base(newpubkeyfile))
+	return writeb64file(outfile, comment, &t, nil, os.O_TRUNC, 0666)
+}
+
+// followchain follows the chain of transition statements starting at the
+// trusted key root and returns all keys which are trusted at time now. Every
+// statement must be signed by the key endorsed by the statement before it,
+// which must not have been revoked by one of the revocation lists. The time of
+// the revocation does not matter, because the holder of a revoked key can
+// backdate statements.
+func followchain(root *pubkey, chain []string, now time.Time, revocations []*RevocationList) ([]pubkey, error) {
+	keys := []pubkey{*root}
+	cur := root
+	for _, file := range chain {
+		var t transition
+		_, buf, err := readb64file(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := binary.Read(bytes.NewReader(buf), binary.BigEndian, &t); err != nil {
+			return nil, err
+		}
+		if string(t.Pkalg[:]) != transitionalg || string(t.Newpkalg[:]) != pkalg {
+			return nil, fmt.Errorf("unsupported file %s", file)
+		}
+		if t.Keynum != cur.Keynum {
+			return nil, fmt.Errorf("transition %s not signed by the previous key", file)
+		}
+		if !ed25519.Verify(cur.Pubkey[:], transitionmsg(&t), t.Sig[:]) {
+			return nil, fmt.Errorf("transition %s: signature verification failed", file)
+		}
+		for _, l := range revocations {
+			if err := l.revoked(cur.Keynum); err != nil {
+				return nil, fmt.Errorf("transition %s: %s", file, err)
+			}
+		}
+		if now.Unix() < t.Notbefore {
+			return nil, fmt.Errorf("transition %s not valid before %s", file,
+				time.Unix(t.Notbefore, 0).UTC().Format(time.RFC3339))
+		}
+		next := pubkey{Pkalg: t.Newpkalg, Keynum: t.Newkeynum, Pubkey: t.Newpubkey}
+		keys = append(keys, next)
+		cur = &keys[len(keys)-1]
+	}
+	return keys, nil
+}
+
+// chainkey returns the key of the chain starting at root which has the key
+// number keynum. Transitions signed by revoked keys are rejected.
+func chainkey(root *pubkey, chain []string, keynum [keynumlen]byte, revocations []*RevocationList) (*pubkey, error) {
+	keys, err := followchain(root, chain, time.Now(), revocations)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		if keys[i].Keynum == keynum {
+			return &keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("key %s not in the transition chain", hex.EncodeToString(keynum[:]))
+}
@@ -0,0 +1,111 @@
+package signify
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTransition(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "signify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	var pubkeys, seckeys []string
+	for i := 0; i < 3; i++ {
+		pubkey := filepath.Join(tmpdir, fmt.Sprintf("key%d.pub", i))
+		seckey := filepath.Join(tmpdir, fmt.Sprintf("key%d.sec", i))
+		if err := Main("signify", "-G", "-n", "-p", pubkey, "-s", seckey); err != nil {
+			t.Fatal(err)
+		}
+		pubkeys = append(pubkeys, pubkey)
+		seckeys = append(seckeys, seckey)
+	}
+	t01 := filepath.Join(tmpdir, "key0-key1.transition")
+	t12 := filepath.Join(tmpdir, "key1-key2.transition")
+	t02 := filepath.Join(tmpdir, "key0-key2.transition")
+	msgfile := filepath.Join(tmpdir, "message.txt")
+	if err := createMsgfile(msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-transition", "-start", "2020-01-01", "-s", seckeys[0],
+		"-p", pubkeys[1], "-x", t01); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-transition", "-s", seckeys[1], "-p", pubkeys[2], "-x", t12); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-transition", "-start", "2999-01-01", "-s", seckeys[0],
+		"-p", pubkeys[2], "-x", t02); err != nil {
+		t.Fatal(err)
+	}
+	// sign with the latest key and verify with the root key
+	if err := Main("signify", "-S", "-s", seckeys[2], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeys[0], "-chain", t01, "-chain", t12,
+		"-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// without the chain
+	if err := Main("signify", "-V", "-q", "-p", pubkeys[0], "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// incomplete chain
+	err = Main("signify", "-V", "-q", "-p", pubkeys[0], "-chain", t01, "-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "not in the transition chain") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeys[0], "-chain", t12, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// transition not yet valid
+	if err := Main("signify", "-V", "-q", "-p", pubkeys[0], "-chain", t02, "-m", msgfile); err == nil {
+		t.Error("should fail")
+	}
+	// earlier keys of the chain stay trusted
+	if err := Main("signify", "-S", "-s", seckeys[1], "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeys[0], "-chain", t01, "-chain", t12,
+		"-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	// the holder of a revoked key cannot backdate a transition
+	attackerpub := filepath.Join(tmpdir, "attacker.pub")
+	attackersec := filepath.Join(tmpdir, "attacker.sec")
+	if err := Main("signify", "-G", "-n", "-p", attackerpub, "-s", attackersec); err != nil {
+		t.Fatal(err)
+	}
+	list := filepath.Join(tmpdir, "revoked.list")
+	if err := Main("signify", "-revoke", "-reason", "key leaked", "-start", "2025-01-01",
+		"-s", seckeys[0], "-p", pubkeys[1], "-x", list); err != nil {
+		t.Fatal(err)
+	}
+	backdated := filepath.Join(tmpdir, "key1-attacker.transition")
+	if err := Main("signify", "-transition", "-start", "2021-01-01", "-s", seckeys[1],
+		"-p", attackerpub, "-x", backdated); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-S", "-s", attackersec, "-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := Main("signify", "-V", "-q", "-p", pubkeys[0], "-chain", t01, "-chain", backdated,
+		"-m", msgfile); err != nil {
+		t.Fatal(err)
+	}
+	err = Main("signify", "-V", "-q", "-revoked", list, "-p", pubkeys[0], "-chain", t01, "-chain", backdated,
+		"-m", msgfile)
+	if err == nil || !strings.Contains(err.Error(), "key leaked") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// a key cannot endorse itself
+	if err := Main("signify", "-transition", "-s", seckeys[0], "-p", pubkeys[0],
+		"-x", filepath.Join(tmpdir, "self.transition")); err == nil {
+		t.Error("should fail")
+	}
+}